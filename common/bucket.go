@@ -0,0 +1,300 @@
+package common
+
+import (
+	"encoding/json"
+	"minio_demo/config"
+	"minio_demo/errorx"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/minio/minio-go"
+	"github.com/zituocn/logx"
+)
+
+// 强制删除桶时每批删除的文件数
+const purgeBatchSize = 1000
+
+// 未配置区域时使用的默认区域
+const defaultRegion = "us-east-1"
+
+// S3 标签数量和长度限制
+const (
+	maxBucketTags     = 50
+	maxBucketTagKey   = 128
+	maxBucketTagValue = 256
+)
+
+// S3 桶命名规则：3-63 位小写字母、数字、点和短横线，以字母或数字开头和结尾
+var bucketNameRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+
+// 创建桶的参数，除桶名和区域外均为可选的初始配置
+type BucketOptions struct {
+	Region     string
+	Versioning bool
+	Policy     string
+	Tags       map[string]string
+	// 存储配额(字节)，0 表示不限制
+	Quota int64
+}
+
+type BucketCreateInfo struct {
+	Name   string `json:"name"`
+	Region string `json:"region"`
+	// 桶已存在且属于当前账号时为 false
+	Created bool `json:"created"`
+}
+
+// 校验桶名
+func validateBucketName(bucketname string) error {
+	invalid := errorx.New(errorx.CodeInvalidBucketName)
+	if !bucketNameRegexp.MatchString(bucketname) {
+		return invalid
+	}
+	if strings.Contains(bucketname, "..") || strings.Contains(bucketname, ".-") || strings.Contains(bucketname, "-.") {
+		return invalid
+	}
+	if net.ParseIP(bucketname) != nil {
+		return invalid
+	}
+	if strings.HasPrefix(bucketname, "xn--") || strings.HasSuffix(bucketname, "-s3alias") {
+		return invalid
+	}
+	return nil
+}
+
+// 解析创建桶的参数：region、versioning、policy(json)、tags(json 对象)、quota(字节)
+func parseBucketOptions(r *http.Request) (*BucketOptions, error) {
+	invalid := errorx.WithMsg(errorx.CodeInternalParamsError, errorx.MsgInvalidBucketOptions)
+	opts := &BucketOptions{Region: r.FormValue("region")}
+	if opts.Region == "" {
+		opts.Region = config.ConfData.Minio.Region
+	}
+	if opts.Region == "" {
+		opts.Region = defaultRegion
+	}
+	if v := r.FormValue("versioning"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, invalid
+		}
+		opts.Versioning = enabled
+	}
+	if v := r.FormValue("policy"); v != "" {
+		if !json.Valid([]byte(v)) {
+			return nil, invalid
+		}
+		opts.Policy = v
+	}
+	if v := r.FormValue("tags"); v != "" {
+		if err := json.Unmarshal([]byte(v), &opts.Tags); err != nil || !validTags(opts.Tags, maxBucketTags) {
+			return nil, invalid
+		}
+	}
+	var err error
+	if opts.Quota, err = parseSize(r.FormValue("quota")); err != nil {
+		return nil, invalid
+	}
+	return opts, nil
+}
+
+// 创建桶并应用初始配置，任一配置失败时删除新建的桶
+// 桶已存在且属于当前账号时直接返回成功，不修改已有配置
+func createBucket(bucketname string, opts *BucketOptions) (*BucketCreateInfo, error) {
+	if err := validateBucketName(bucketname); err != nil {
+		return nil, err
+	}
+	info := &BucketCreateInfo{Name: bucketname, Region: opts.Region}
+	if err := store.MakeBucket(bucketname, opts.Region); err != nil {
+		if minio.ToErrorResponse(err).Code == "BucketAlreadyOwnedByYou" {
+			return info, nil
+		}
+		return nil, err
+	}
+	info.Created = true
+
+	if err := applyBucketOptions(bucketname, opts); err != nil {
+		logx.Errorf("create bucket:%s apply options %v, rollback", bucketname, err)
+		if err := store.RemoveBucket(bucketname); err != nil {
+			logx.Errorf("rollback bucket:%s %v", bucketname, err)
+		}
+		metadata.SetBucketQuota(bucketname, 0)
+		return nil, err
+	}
+	// 默认规则失败时分片仍会由合并和清理任务删除，不回滚
+	if err := ensureChunkRule(bucketname); err != nil {
+		logx.Errorf("create bucket:%s install chunk rule %v", bucketname, err)
+	}
+	return info, nil
+}
+
+func applyBucketOptions(bucketname string, opts *BucketOptions) error {
+	if opts.Versioning {
+		if err := store.SetBucketVersioning(bucketname, true); err != nil {
+			return err
+		}
+	}
+	if opts.Policy != "" {
+		if err := store.SetBucketPolicy(bucketname, opts.Policy); err != nil {
+			return err
+		}
+	}
+	if len(opts.Tags) > 0 {
+		if err := store.SetBucketTagging(bucketname, opts.Tags); err != nil {
+			return err
+		}
+	}
+	if opts.Quota > 0 {
+		// 新建的桶为空，清除同名旧桶残留的用量
+		if err := metadata.SetBucketUsage(bucketname, 0); err != nil {
+			return err
+		}
+		return metadata.SetBucketQuota(bucketname, opts.Quota)
+	}
+	return nil
+}
+
+// 写入 size 字节后是否超出桶配额，已用容量由 usageStore 在写入和删除时统计
+func checkQuota(bucketname string, size int64) error {
+	quota, err := metadata.GetBucketQuota(bucketname)
+	if err != nil || quota <= 0 {
+		return err
+	}
+	used, err := metadata.GetBucketUsage(bucketname)
+	if err != nil {
+		return err
+	}
+	if used+size > quota {
+		return errorx.New(errorx.CodeQuotaExceeded)
+	}
+	return nil
+}
+
+// 强制删除桶的结果
+type PurgeResult struct {
+	RemovedObjects int `json:"removedObjects"`
+	AbortedUploads int `json:"abortedUploads"`
+	FailedObjects  int `json:"failedObjects"`
+	// 开启过版本控制时删除的历史版本和删除标记
+	RemovedVersions int `json:"removedVersions"`
+}
+
+// 删除桶，force 为 true 时先清空桶，confirm 必须与桶名一致
+func removeBucket(bucketname string, force bool, confirm string) (*PurgeResult, error) {
+	if isExist, err := IsBuckets(bucketname); err != nil {
+		return nil, err
+	} else if !isExist {
+		return nil, errorx.New(errorx.CodeBucketNotFound)
+	}
+	if !force {
+		return nil, store.RemoveBucket(bucketname)
+	}
+	if confirm != bucketname {
+		return nil, errorx.WithMsg(errorx.CodeInternalParamsError, errorx.MsgConfirmBucketName)
+	}
+
+	// 失败时把已完成的进度随错误返回给调用方
+	result, err := purgeBucket(bucketname)
+	if err == nil {
+		err = store.RemoveBucket(bucketname)
+	}
+	if err != nil {
+		return result, errorx.From(err).WithData(result)
+	}
+	return result, nil
+}
+
+// 清空桶：取消未完成的分段上传，分批删除全部文件（包括分片临时文件），清理文件记录和上传会话
+func purgeBucket(bucketname string) (*PurgeResult, error) {
+	result := &PurgeResult{}
+	doneCh := make(chan struct{})
+	defer close(doneCh)
+
+	for upload := range store.ListIncompleteUploads(bucketname, "", true, doneCh) {
+		if upload.Err != nil {
+			return result, upload.Err
+		}
+		if err := store.AbortMultipartUpload(bucketname, upload.Key, upload.UploadID); err != nil {
+			logx.Errorf("purge bucket:%s abort upload:%s %v", bucketname, upload.UploadID, err)
+			continue
+		}
+		result.AbortedUploads++
+	}
+
+	batch := make([]string, 0, purgeBatchSize)
+	flush := func() {
+		failed := removeObjects(bucketname, batch)
+		result.RemovedObjects += len(batch) - len(failed)
+		result.FailedObjects += len(failed)
+		logx.Info("purge bucket:" + bucketname + " removed:" + strconv.Itoa(result.RemovedObjects) + " failed:" + strconv.Itoa(result.FailedObjects))
+		batch = batch[:0]
+	}
+	for object := range store.ListObjects(bucketname, "", true, doneCh) {
+		if object.Err != nil {
+			return result, object.Err
+		}
+		batch = append(batch, object.Key)
+		if len(batch) == purgeBatchSize {
+			flush()
+		}
+	}
+	if len(batch) > 0 {
+		flush()
+	}
+	if err := purgeVersions(bucketname, result); err != nil {
+		return result, err
+	}
+	if result.FailedObjects > 0 {
+		return result, errorx.New(errorx.CodeBucketNotEmpty)
+	}
+
+	if err := metadata.DeleteBucket(bucketname); err != nil {
+		return result, err
+	}
+	removeBucketSessions(bucketname)
+	return result, nil
+}
+
+// 删除桶内所有历史版本和删除标记，未开启过版本控制时跳过
+func purgeVersions(bucketname string, result *PurgeResult) error {
+	status, err := store.GetBucketVersioning(bucketname)
+	if err != nil || status == "" {
+		return err
+	}
+	for {
+		// 删除后从头查询，失败的版本会留在列表中，所以失败时停止
+		page, err := store.ListObjectVersions(bucketname, "", "", "", purgeBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(page.Versions) == 0 {
+			return nil
+		}
+		failed, err := store.RemoveObjectVersions(bucketname, page.Versions)
+		if err != nil {
+			return err
+		}
+		result.RemovedVersions += len(page.Versions) - len(failed)
+		logx.Info("purge bucket:" + bucketname + " removed versions:" + strconv.Itoa(result.RemovedVersions) + " failed:" + strconv.Itoa(len(failed)))
+		if len(failed) > 0 {
+			result.FailedObjects += len(failed)
+			return nil
+		}
+	}
+}
+
+// 删除桶内的上传会话
+func removeBucketSessions(bucketname string) {
+	list, err := sessions.List()
+	if err != nil {
+		logx.Error("sessions.List error:", err.Error())
+		return
+	}
+	for _, session := range list {
+		if session.BucketName == bucketname {
+			sessions.Delete(session.Key())
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package common
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/minio/minio-go"
+	"github.com/zituocn/logx"
+)
+
+var (
+	ErrChunkChecksumMismatch = errors.New("chunk checksum mismatch")
+	ErrChecksumAlgorithm     = errors.New("unsupported checksum algorithm")
+	ErrChecksumPerFile       = errors.New("checksum must be provided per file")
+)
+
+// S3 单次 PUT 的最大对象大小，超过时只能分段上传，无法由存储端校验 Content-MD5
+const maxSinglePutSize = 5 * 1024 * 1024 * 1024
+
+// 暂存对象的前缀，校验通过后复制到目标位置，残留的暂存对象由清理任务删除
+const stagingPrefix = ".staging/"
+
+const (
+	ChecksumMD5    = "md5"
+	ChecksumSHA256 = "sha256"
+	ChecksumCRC32C = "crc32c"
+)
+
+// 客户端声明的分片校验值，hex 或 base64 编码
+type Checksum struct {
+	Algorithm string
+	Value     string
+}
+
+// 从表单字段 checksum/checksumAlgorithm 读取校验值，未提供时返回 nil
+// 表单请求的 Content-MD5 请求头是整个请求体的摘要，不是文件内容的，不能使用
+func parseChecksum(r *http.Request) (*Checksum, error) {
+	return formChecksum(r, "checksum", "checksumAlgorithm")
+}
+
+// put_object 中表单字段 field 对应文件的校验值
+// 多个文件时每个文件使用 checksum_<field>、checksumAlgorithm_<field>，checksum 只能用于单个文件
+func parseFileChecksum(r *http.Request, field string) (*Checksum, error) {
+	if len(r.MultipartForm.File) > 1 && r.PostFormValue("checksum") != "" {
+		return nil, ErrChecksumPerFile
+	}
+	if r.PostFormValue("checksum_"+field) != "" {
+		return formChecksum(r, "checksum_"+field, "checksumAlgorithm_"+field)
+	}
+	return parseChecksum(r)
+}
+
+func formChecksum(r *http.Request, valueField, algorithmField string) (*Checksum, error) {
+	value := r.PostFormValue(valueField)
+	if value == "" {
+		return nil, nil
+	}
+	algorithm := strings.ToLower(r.PostFormValue(algorithmField))
+	if algorithm == "" {
+		algorithm = ChecksumMD5
+	}
+	switch algorithm {
+	case ChecksumMD5, ChecksumSHA256, ChecksumCRC32C:
+		return &Checksum{Algorithm: algorithm, Value: value}, nil
+	default:
+		return nil, ErrChecksumAlgorithm
+	}
+}
+
+// 从请求头 Content-MD5、X-Amz-Checksum-* 读取校验值，未提供时返回 nil
+// 只用于请求体即文件内容的 REST PUT
+func parseChecksumHeader(r *http.Request) *Checksum {
+	if value := r.Header.Get("Content-MD5"); value != "" {
+		return &Checksum{Algorithm: ChecksumMD5, Value: value}
+	}
+	if value := r.Header.Get("X-Amz-Checksum-Sha256"); value != "" {
+		return &Checksum{Algorithm: ChecksumSHA256, Value: value}
+	}
+	if value := r.Header.Get("X-Amz-Checksum-Crc32c"); value != "" {
+		return &Checksum{Algorithm: ChecksumCRC32C, Value: value}
+	}
+	return nil
+}
+
+func (c *Checksum) newHash() hash.Hash {
+	switch c.Algorithm {
+	case ChecksumSHA256:
+		return sha256.New()
+	case ChecksumCRC32C:
+		return crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	default:
+		return md5.New()
+	}
+}
+
+func (c *Checksum) matches(sum []byte) bool {
+	return strings.EqualFold(c.Value, hex.EncodeToString(sum)) || c.Value == base64.StdEncoding.EncodeToString(sum)
+}
+
+// 校验值解码为原始字节，hex 或 base64 编码
+func (c *Checksum) decode() ([]byte, error) {
+	if sum, err := hex.DecodeString(c.Value); err == nil {
+		return sum, nil
+	}
+	return base64.StdEncoding.DecodeString(c.Value)
+}
+
+// 写入对象并校验客户端声明的校验值，不一致时返回 ErrChecksumMismatch，不覆盖已有对象
+// md5 由存储端按 Content-MD5 校验；其他算法先写入暂存对象，校验通过后复制到目标位置
+func putObjectChecked(bucketname, objectname string, reader io.Reader, size int64, opts minio.PutObjectOptions, checksum *Checksum) (int64, error) {
+	if checksum == nil {
+		return store.PutObject(bucketname, objectname, reader, size, opts)
+	}
+	if checksum.Algorithm == ChecksumMD5 && size >= 0 && size <= maxSinglePutSize {
+		sum, err := checksum.decode()
+		if err != nil || len(sum) != md5.Size {
+			return 0, ErrChecksumMismatch
+		}
+		n, err := store.PutObjectMd5(bucketname, objectname, reader, size, base64.StdEncoding.EncodeToString(sum), opts)
+		if minio.ToErrorResponse(err).Code == "BadDigest" {
+			return 0, ErrChecksumMismatch
+		}
+		return n, err
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return 0, err
+	}
+	staging := stagingPrefix + token
+	checksumHash := checksum.newHash()
+	n, err := store.PutObject(bucketname, staging, io.TeeReader(reader, checksumHash), size, opts)
+	if err != nil {
+		return 0, err
+	}
+	defer removeStaging(bucketname, staging)
+	if !checksum.matches(checksumHash.Sum(nil)) {
+		return 0, ErrChecksumMismatch
+	}
+	// userMeta 为 nil 时保留暂存对象的元数据
+	if err := store.CopyObject(bucketname, objectname, CopySrc{BucketName: bucketname, Name: staging, Size: n}, nil); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// 永久删除暂存对象，开启过版本控制时删除暂存写入的版本而不是添加删除标记
+func removeStaging(bucketname, objectname string) {
+	versionId := ""
+	if stat, err := store.StatObject(bucketname, objectname, minio.StatObjectOptions{}); err == nil {
+		versionId = stat.Metadata.Get(headerVersionId)
+	}
+	var err error
+	if versionId != "" {
+		err = store.RemoveObjectVersion(bucketname, objectname, versionId)
+	} else {
+		err = store.RemoveObject(bucketname, objectname)
+	}
+	if err != nil {
+		logx.Errorf("remove staging %s/%s %v", bucketname, objectname, err)
+	}
+}
+
+// 写入对象元数据的校验信息
+func (c *Checksum) userMetadata() map[string]string {
+	return map[string]string{
+		"Checksum-Algorithm": c.Algorithm,
+		"Checksum":           c.Value,
+	}
+}
@@ -1,7 +1,12 @@
 package common
 
 import (
+	"crypto/md5"
+	"encoding/hex"
 	"errors"
+	"io"
+	"minio_demo/errorx"
+	"net/http"
 	"sort"
 	"strconv"
 	"strings"
@@ -24,21 +29,10 @@ func partSort(shardPaths []SrcInfo) func(int, int) bool {
 }
 
 // minio合并分片小于5M时，会报错
-func ComposeObject(bucketname, dst_name, md5 string, shardPaths []SrcInfo) error {
+func ComposeObject(bucketname, dst_name, md5 string, shardPaths []SrcInfo, userMeta map[string]string) error {
 	sort.SliceStable(shardPaths, partSort(shardPaths))
 
-	src_list := make([]minio.SourceInfo, 0)
-	for _, v := range shardPaths {
-		item := minio.NewSourceInfo(bucketname, v.Name, nil)
-		item.SetMatchETagCond(v.Etag)
-		src_list = append(src_list, item)
-	}
-	dst, err := minio.NewDestinationInfo(bucketname, dst_name, nil, nil)
-	if err != nil {
-		logx.Error("NewDestinationInfo error:", err)
-		return err
-	}
-	err = client.ComposeObject(dst, src_list)
+	err := store.ComposeObject(bucketname, dst_name, shardPaths, userMeta)
 	if err != nil {
 		logx.Error("ComposeObject error:", err)
 		return err
@@ -48,27 +42,20 @@ func ComposeObject(bucketname, dst_name, md5 string, shardPaths []SrcInfo) error
 
 // 批量删除文件
 func removeObjectList(paths []SrcInfo, bucketname string) error {
-	fileCh := make(chan string, len(paths))
-	defer close(fileCh)
+	names := make([]string, 0, len(paths))
 	for _, file := range paths {
-		fileCh <- file.Name
-	}
-	ch := client.RemoveObjects(bucketname, fileCh)
-	select {
-	case err := <-ch:
-		if err.Err != nil {
-			logx.Errorf("remove: bucketname%s %v", bucketname, err)
-			return err.Err
-		}
-	default:
-		logx.Info("removeObjectList success")
+		names = append(names, file.Name)
 	}
+	for _, err := range removeObjects(bucketname, names) {
+		return err
+	}
+	logx.Info("removeObjectList success")
 	return nil
 }
 
 // 桶是否存在
 func IsBuckets(name string) (bool, error) {
-	isExist, err := client.BucketExists(name)
+	isExist, err := store.BucketExists(name)
 
 	if err != nil {
 		logx.Errorf("Check %s err:%s", name, err.Error())
@@ -79,7 +66,12 @@ func IsBuckets(name string) (bool, error) {
 
 // 获取对象信息
 func GetStatObject(bucketname, objectname string) (*FileSaveInfo, error) {
-	info, err := client.StatObject(bucketname, objectname, minio.StatObjectOptions{})
+	return GetStatObjectVersion(bucketname, objectname, "")
+}
+
+// 获取指定版本的对象信息，versionId 为空时为最新版本
+func GetStatObjectVersion(bucketname, objectname, versionId string) (*FileSaveInfo, error) {
+	info, err := store.StatObjectVersion(bucketname, objectname, versionId)
 	if err != nil {
 		logx.Errorf("StatObject error: %v", err)
 		return nil, err
@@ -90,6 +82,10 @@ func GetStatObject(bucketname, objectname string) (*FileSaveInfo, error) {
 		LastModified: info.LastModified.Format("2006-01-02 15:04:05"),
 		Size:         info.Size,
 		Md5:          info.ETag,
+		VersionId:    info.Metadata.Get(headerVersionId),
+		ContentType:  info.ContentType,
+		StorageClass: info.StorageClass,
+		Metadata:     userMetadata(info.Metadata),
 	}, nil
 }
 
@@ -101,37 +97,270 @@ func removeBackslashAndQuotes(str string) string {
 
 // 根据md5值查询文件记录
 func GetInfoForIdentifier(md5 string) (*FileSaveInfo, error) {
-	n, err := redisdb.Exists(md5).Result()
-	if err != nil || n == 0 {
-		logx.Notice("redisdb.Exists md5 not found")
-		return nil, errors.New("redisdb.Exists md5 not found")
+	info, err := metadata.GetByMd5(md5)
+	if err != nil {
+		logx.Notice("metadata md5 not found")
+		return nil, err
 	}
-	info := &FileSaveInfo{}
-	err = redisdb.Get(md5).Scan(info)
+	// 索引指向的对象已删除或被覆盖时不能秒传
+	stat, err := store.StatObjectVersion(info.BucketName, info.ObjectName, info.VersionId)
 	if err != nil {
-		logx.Notice("redisdb.Get md5 not found")
+		logx.Noticef("metadata md5 %s/%s %s: %v", info.BucketName, info.ObjectName, info.VersionId, err)
+		if code := errorx.From(err).Code; code == errorx.CodeVersionNotFound || code == errorx.CodeObjectNotFound || code == errorx.CodeMethodNotAllowed {
+			metadata.DeleteVersion(info)
+			return nil, ErrMetadataNotFound
+		}
 		return nil, err
 	}
-
+	if !sameContent(info, stat) {
+		logx.Noticef("metadata md5 %s/%s overwritten", info.BucketName, info.ObjectName)
+		metadata.DeleteMd5(md5, info)
+		return nil, ErrMetadataNotFound
+	}
 	return info, nil
 }
 
+// 对象是否仍是记录写入时的内容，合并上传的 ETag 不是md5，只比较大小和修改时间
+func sameContent(info *FileSaveInfo, stat minio.ObjectInfo) bool {
+	if stat.Size != info.Size || stat.LastModified.Format("2006-01-02 15:04:05") != info.LastModified {
+		return false
+	}
+	etag := removeBackslashAndQuotes(stat.ETag)
+	return !isMd5(etag) || strings.EqualFold(etag, info.Md5)
+}
+
 // 根据文件名、桶名获取文件记录
 func GetFileSaveInfo(bucketname, filename string) (*FileSaveInfo, error) {
-	flag, err := redisdb.HExists(bucketname, filename).Result()
-	if err != nil || !flag {
-		logx.Notice("redis HExists bucketname:%s,filename:%s not found", bucketname, filename)
-	}
-	info := &FileSaveInfo{}
-	err = redisdb.HGet(bucketname, filename).Scan(&is_exists_key)
+	record, err := metadata.GetByName(bucketname, filename)
 	if err != nil {
-		logx.Notice("redis HGet bucketname:%s,filename:%s not found", bucketname, filename)
+		logx.Notice("metadata bucketname:%s,filename:%s not found", bucketname, filename)
 	}
 
-	info, err = GetStatObject(bucketname, filename)
+	info, err := GetStatObject(bucketname, filename)
 	if err != nil {
 		return nil, err
 	}
-	redisdb.HSet(bucketname, filename, info)
+	// 对象未被覆盖时沿用记录中校验过的md5
+	if record != nil && record.Size == info.Size && record.LastModified == info.LastModified {
+		return record, nil
+	}
+	if err := metadata.Save("", info); err != nil {
+		logx.Error("metadata Save error:", err.Error())
+	}
 	return info, err
 }
+
+// 分片对象名
+func chunkObjectName(key string, chunkNumber int) string {
+	return key + "/" + strconv.Itoa(chunkNumber) + ".part"
+}
+
+// 从分片对象名解析分片编号
+func parseChunkNumber(objectname string) (int, bool) {
+	arr := strings.Split(objectname, "/")
+	if len(arr) < 2 {
+		return 0, false
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(arr[len(arr)-1], ".part"))
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+func hasChunk(chunks []int, chunkNumber int) bool {
+	for _, v := range chunks {
+		if v == chunkNumber {
+			return true
+		}
+	}
+	return false
+}
+
+// 上传当前分片到临时文件并标记到会话
+// 上传时计算分片md5与存储端比对，客户端提供校验值时同时校验并写入对象元数据
+// 分片按顺序到达时同时计入文件摘要，合并时不需要重新读取
+func putChunk(r *http.Request, bucketname string, session *UploadSession, chunkNumber int, checksum *Checksum) error {
+	key := session.Key()
+	objectname := chunkObjectName(key, chunkNumber)
+	var sum string
+	var digest *FileDigest
+	for k := range r.MultipartForm.File {
+		file, fileHeader, err := r.FormFile(k)
+		if err != nil {
+			logx.Error("FormFile error:", err.Error())
+			return err
+		}
+		defer file.Close()
+		if err := checkQuota(bucketname, fileHeader.Size); err != nil {
+			return err
+		}
+
+		opts := minio.PutObjectOptions{}
+		if checksum != nil {
+			opts.UserMetadata = checksum.userMetadata()
+		}
+		tagChunk(&opts)
+		// 校验失败时不写入，已上传的同编号分片保持不变
+		md5Hash := md5.New()
+		var writer io.Writer = md5Hash
+		fileHash := resumeDigest(session.Digest, chunkNumber)
+		if fileHash != nil {
+			writer = io.MultiWriter(md5Hash, fileHash)
+		}
+		n, err := putObjectChecked(bucketname, objectname, io.TeeReader(file, writer), fileHeader.Size, opts, checksum)
+		if err == ErrChecksumMismatch {
+			logx.Errorf("chunk %s %s mismatch", objectname, checksum.Algorithm)
+			return ErrChunkChecksumMismatch
+		}
+		if err != nil {
+			logx.Error("PutObject chunk error:", err.Error())
+			return err
+		}
+		sum = hex.EncodeToString(md5Hash.Sum(nil))
+		digest = advanceDigest(session.Digest, fileHash, chunkNumber, n)
+		stat, err := store.StatObject(bucketname, objectname, minio.StatObjectOptions{})
+		if err != nil {
+			return err
+		}
+		// 分段上传或加密对象的 ETag 不是md5，无法比对
+		if etag := removeBackslashAndQuotes(stat.ETag); isMd5(etag) && etag != sum {
+			logx.Errorf("chunk %s md5 mismatch: %s != %s", objectname, etag, sum)
+			store.RemoveObject(bucketname, objectname)
+			return ErrChunkChecksumMismatch
+		}
+		logx.Info("Successfully uploaded bytes: ", n)
+	}
+	// 标记上传分片
+	return sessions.AddChunk(key, chunkNumber, sum, digest)
+}
+
+// 分片上传错误，校验失败时返回对应的错误码
+func chunkError(err error) error {
+	switch err {
+	case ErrChecksumMismatch:
+		return errorx.New(errorx.CodeChecksumMismatch)
+	case ErrChunkChecksumMismatch:
+		return errorx.New(errorx.CodeChunkChecksumMismatch)
+	}
+	return err
+}
+
+// 查询已上传的分片文件
+func listChunks(bucketname, key string, chunkNumber, totalChunks int) (shardPaths []SrcInfo, size int64, isUploaded bool) {
+	doneCh := make(chan struct{})
+	defer close(doneCh)
+
+	shardPaths = make([]SrcInfo, 0)
+	for message := range store.ListObjects(bucketname, key+"/", true, doneCh) {
+		if message.Err != nil {
+			logx.Error("ListObjects error:", message.Err.Error())
+			continue
+		}
+		v, ok := parseChunkNumber(message.Key)
+		if !ok || v <= 0 || v > totalChunks {
+			continue
+		}
+		// 标记分片已上传状态
+		if v == chunkNumber {
+			isUploaded = true
+		}
+		shardPaths = append(shardPaths, SrcInfo{
+			Name: message.Key,
+			Etag: message.ETag,
+		})
+		size += message.Size
+	}
+	return shardPaths, size, isUploaded
+}
+
+// 校验分片md5后合并，合并后清理临时文件并写入文件记录
+func mergeChunks(bucketname, filename, identifier string, shardPaths []SrcInfo, session *UploadSession) (*FileSaveInfo, error) {
+	meta := session.Meta
+	if meta == nil {
+		meta = &ObjectMeta{}
+	}
+	sort.SliceStable(shardPaths, partSort(shardPaths))
+	// 合并前校验，不一致时不写入，同名文件保持不变
+	verified, err := verifyChunksMd5(bucketname, identifier, session, shardPaths)
+	if err != nil {
+		if err == ErrChecksumMismatch {
+			// 分片数据与客户端声明的md5不一致，丢弃分片，客户端需重新上传
+			removeObjectList(shardPaths, bucketname)
+		}
+		return nil, err
+	}
+	contentType := meta.detectContentType(filename, "", func() []byte {
+		return objectHead(bucketname, shardPaths[0].Name)
+	})
+	// 合并时 Content-Type 与自定义元数据一起写入
+	userMeta := meta.putOptions(contentType, nil).UserMetadata
+	userMeta["Content-Type"] = contentType
+	if err := ComposeObject(bucketname, filename, identifier, shardPaths, userMeta); err != nil {
+		return nil, err
+	}
+	// 删除临时文件
+	removeObjectList(shardPaths, bucketname)
+	if err := untagMergedChunk(bucketname, filename, shardPaths, meta.Tags); err != nil {
+		return nil, err
+	}
+	// 检查文件
+	info, err := GetStatObject(bucketname, filename)
+	if err != nil {
+		logx.Error("查询上传记录:%s\n", err.Error())
+		return nil, err
+	}
+	// 标记md5值和桶名、文件名，后续处理相同md5值的文件以及同名但是MD5值不同的文件
+	// 只有校验通过的md5才能用于秒传
+	md5sum := ""
+	if verified {
+		md5sum = identifier
+		info.Md5 = identifier
+	}
+	info.Tags = meta.Tags
+	if err := metadata.Save(md5sum, info); err != nil {
+		logx.Info("metadata Save Error：", err.Error())
+	}
+	return info, nil
+}
+
+// 读取对象开头的内容，用于识别类型
+func objectHead(bucketname, objectname string) []byte {
+	object, err := store.GetObject(bucketname, objectname, minio.GetObjectOptions{})
+	if err != nil {
+		return nil
+	}
+	defer object.Close()
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(object, head)
+	return head[:n]
+}
+
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// 是否为md5格式
+func isMd5(str string) bool {
+	if len(str) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(str)
+	return err == nil
+}
+
+// 校验分片内容与客户端声明的md5是否一致
+// identifier 不是md5格式时不做校验，返回 false，此时文件不参与秒传
+func verifyChunksMd5(bucketname, identifier string, session *UploadSession, shardPaths []SrcInfo) (bool, error) {
+	if !isMd5(strings.ToLower(identifier)) {
+		return false, nil
+	}
+	sum, err := chunksMd5(bucketname, session, shardPaths)
+	if err != nil {
+		logx.Error("chunksMd5 error:", err.Error())
+		return false, err
+	}
+	if sum != strings.ToLower(identifier) {
+		logx.Errorf("chunks %s md5 mismatch: %s != %s", session.Key(), sum, identifier)
+		return false, ErrChecksumMismatch
+	}
+	return true, nil
+}
@@ -0,0 +1,180 @@
+package common
+
+import (
+	"encoding/json"
+	"minio_demo/errorx"
+	"net/http"
+	"strconv"
+
+	"github.com/minio/minio-go"
+	"github.com/zituocn/logx"
+)
+
+// 复制、移动的参数
+type CopyOptions struct {
+	SrcBucket string
+	SrcObject string
+	DstBucket string
+	DstObject string
+	// 为 nil 时保留源对象的元数据，否则不能为空
+	UserMeta map[string]string
+}
+
+// 解析参数：src_bucket、src_object、dst_bucket(默认源桶)、dst_object(默认源文件名)、
+// replace_metadata 为 true 时使用 metadata(json 对象) 和 content_type 替换源对象的元数据，两者不能都为空
+func parseCopyOptions(r *http.Request) (*CopyOptions, error) {
+	invalid := errorx.WithMsg(errorx.CodeInternalParamsError, errorx.MsgInvalidCopyOptions)
+	opts := &CopyOptions{
+		SrcBucket: r.FormValue("src_bucket"),
+		SrcObject: r.FormValue("src_object"),
+		DstBucket: r.FormValue("dst_bucket"),
+		DstObject: r.FormValue("dst_object"),
+	}
+	if opts.SrcBucket == "" || opts.SrcObject == "" {
+		return nil, invalid
+	}
+	if opts.DstBucket == "" {
+		opts.DstBucket = opts.SrcBucket
+	}
+	if opts.DstObject == "" {
+		opts.DstObject = opts.SrcObject
+	}
+
+	replace := false
+	if v := r.FormValue("replace_metadata"); v != "" {
+		var err error
+		if replace, err = strconv.ParseBool(v); err != nil {
+			return nil, invalid
+		}
+	}
+	if replace {
+		opts.UserMeta = make(map[string]string)
+		if v := r.FormValue("metadata"); v != "" {
+			if err := json.Unmarshal([]byte(v), &opts.UserMeta); err != nil {
+				return nil, invalid
+			}
+		}
+		if v := r.FormValue("content_type"); v != "" {
+			opts.UserMeta["Content-Type"] = v
+		}
+		// 元数据为空时 minio 不发送 REPLACE 指令，会保留源对象的元数据
+		if len(opts.UserMeta) == 0 {
+			return nil, invalid
+		}
+	}
+	// 复制到自身只能用于替换元数据
+	if opts.SrcBucket == opts.DstBucket && opts.SrcObject == opts.DstObject && opts.UserMeta == nil {
+		return nil, invalid
+	}
+	return opts, nil
+}
+
+// 服务端复制对象，确认目标对象写入后更新文件记录
+// 同一个桶内移动不改变已用容量，不检查配额
+func copyObject(opts *CopyOptions, move bool) (*FileSaveInfo, error) {
+	if isExist, err := IsBuckets(opts.DstBucket); err != nil {
+		return nil, err
+	} else if !isExist {
+		return nil, errorx.New(errorx.CodeBucketNotFound)
+	}
+	stat, err := store.StatObject(opts.SrcBucket, opts.SrcObject, minio.StatObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if !move || opts.DstBucket != opts.SrcBucket {
+		if err := checkQuota(opts.DstBucket, stat.Size); err != nil {
+			return nil, err
+		}
+	}
+
+	src := CopySrc{BucketName: opts.SrcBucket, Name: opts.SrcObject, Etag: stat.ETag, Size: stat.Size}
+	if err := store.CopyObject(opts.DstBucket, opts.DstObject, src, opts.UserMeta); err != nil {
+		logx.Errorf("copy %s/%s to %s/%s %v", opts.SrcBucket, opts.SrcObject, opts.DstBucket, opts.DstObject, err)
+		return nil, err
+	}
+	info, err := GetStatObject(opts.DstBucket, opts.DstObject)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size != stat.Size {
+		logx.Errorf("copy %s/%s size mismatch: %d != %d", opts.DstBucket, opts.DstObject, info.Size, stat.Size)
+		return nil, errorx.New(errorx.CodeInternalServerError)
+	}
+	info.Md5 = removeBackslashAndQuotes(info.Md5)
+	// 分段复制的 ETag 不是md5，沿用源文件记录中的md5
+	if record, err := metadata.GetByName(opts.SrcBucket, opts.SrcObject); err == nil && record.Md5 != "" {
+		info.Md5 = record.Md5
+	}
+	if err := metadata.Save("", info); err != nil {
+		logx.Error("metadata Save error:", err.Error())
+	}
+	return info, nil
+}
+
+// 移动对象：复制成功后删除源对象，源对象的md5索引指向新位置
+func moveObject(opts *CopyOptions) (*FileSaveInfo, error) {
+	// 只有校验过的md5才有索引，对象的 ETag 未经校验，不能用于秒传
+	indexed := ""
+	if record, err := metadata.GetByName(opts.SrcBucket, opts.SrcObject); err == nil && record.Md5 != "" {
+		if v, err := metadata.GetByMd5(record.Md5); err == nil && sameObject(v, record) {
+			indexed = record.Md5
+		}
+	}
+	info, err := copyObject(opts, true)
+	if err != nil {
+		return nil, err
+	}
+	if opts.SrcBucket == opts.DstBucket && opts.SrcObject == opts.DstObject {
+		return info, nil
+	}
+	if err := store.RemoveObject(opts.SrcBucket, opts.SrcObject); err != nil {
+		logx.Errorf("move: remove %s/%s %v", opts.SrcBucket, opts.SrcObject, err)
+		return nil, err
+	}
+	if err := metadata.Delete(opts.SrcBucket, opts.SrcObject); err != nil {
+		logx.Error("metadata Delete error:", err.Error())
+	}
+	if indexed != "" {
+		if err := metadata.Save(indexed, info); err != nil {
+			logx.Error("metadata Save error:", err.Error())
+		}
+	}
+	return info, nil
+}
+
+// 复制对象
+func CopyObject(w http.ResponseWriter, r *http.Request) {
+	opts, err := parseCopyOptions(r)
+	if err != nil {
+		errorx.WriteOk(w, r, err)
+		return
+	}
+	if !checkPermission(w, r, opts.SrcBucket, ActionRead) || !checkPermission(w, r, opts.DstBucket, ActionWrite) {
+		return
+	}
+	info, err := copyObject(opts, false)
+	if err != nil {
+		errorx.WriteOk(w, r, err)
+		return
+	}
+	errorx.OkMsg(w, r, errorx.MsgObjectCopied, info)
+}
+
+// 移动对象
+func MoveObject(w http.ResponseWriter, r *http.Request) {
+	opts, err := parseCopyOptions(r)
+	if err != nil {
+		errorx.WriteOk(w, r, err)
+		return
+	}
+	if !checkPermission(w, r, opts.SrcBucket, ActionRead) || !checkPermission(w, r, opts.SrcBucket, ActionDelete) ||
+		!checkPermission(w, r, opts.DstBucket, ActionWrite) {
+		return
+	}
+	info, err := moveObject(opts)
+	if err != nil {
+		errorx.WriteOk(w, r, err)
+		return
+	}
+	errorx.OkMsg(w, r, errorx.MsgObjectMoved, info)
+}
@@ -0,0 +1,119 @@
+package common
+
+import (
+	"crypto/md5"
+	"encoding"
+	"encoding/hex"
+	"hash"
+	"io"
+	"strings"
+
+	"github.com/minio/minio-go"
+	"github.com/zituocn/logx"
+)
+
+// 上传过程中按分片顺序计算的文件md5，分片 1..Chunks 已计入
+type FileDigest struct {
+	Chunks int   `json:"chunks"`
+	Size   int64 `json:"size"`
+	// md5 的中间状态
+	State []byte `json:"state"`
+}
+
+// 下一个可以计入摘要的分片编号
+func (d *FileDigest) next() int {
+	if d == nil {
+		return 1
+	}
+	return d.Chunks + 1
+}
+
+// 恢复摘要状态，chunkNumber 不是下一个可以计入的分片时返回 nil
+func resumeDigest(d *FileDigest, chunkNumber int) hash.Hash {
+	if chunkNumber != d.next() {
+		return nil
+	}
+	h := md5.New()
+	if d == nil {
+		return h
+	}
+	if err := h.(encoding.BinaryUnmarshaler).UnmarshalBinary(d.State); err != nil {
+		logx.Error("resume digest error:", err.Error())
+		return nil
+	}
+	return h
+}
+
+// 计入分片后的摘要，h 为 resumeDigest 返回并写入分片内容后的状态
+func advanceDigest(d *FileDigest, h hash.Hash, chunkNumber int, size int64) *FileDigest {
+	if h == nil {
+		return nil
+	}
+	state, err := h.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		logx.Error("marshal digest error:", err.Error())
+		return nil
+	}
+	next := &FileDigest{Chunks: chunkNumber, Size: size, State: state}
+	if d != nil {
+		next.Size += d.Size
+	}
+	return next
+}
+
+// 会话摘要是否仍对应 etags 中的前 Chunks 个分片，etags 按分片编号排列，从 1 开始
+// 分片被重新上传或与记录的md5不一致时不能使用
+func digestUsable(session *UploadSession, etags []string) bool {
+	d := session.Digest
+	if d == nil || d.Chunks > len(etags) {
+		return false
+	}
+	for i := 0; i < d.Chunks; i++ {
+		etag := removeBackslashAndQuotes(etags[i])
+		if isMd5(etag) && !strings.EqualFold(etag, session.ChunkMd5[i+1]) {
+			return false
+		}
+	}
+	return true
+}
+
+// 计算分片文件的md5，已计入会话摘要的分片不再读取
+// shardPaths 为按编号排序的全部分片
+func chunksMd5(bucketname string, session *UploadSession, shardPaths []SrcInfo) (string, error) {
+	etags := make([]string, 0, len(shardPaths))
+	for _, v := range shardPaths {
+		etags = append(etags, v.Etag)
+	}
+	h := md5.New()
+	covered := 0
+	if digestUsable(session, etags) {
+		if resumed := resumeDigest(session.Digest, session.Digest.Chunks+1); resumed != nil {
+			h, covered = resumed, session.Digest.Chunks
+		}
+	}
+	for _, v := range shardPaths[covered:] {
+		if err := readMd5(h, bucketname, v.Name, 0); err != nil {
+			return "", err
+		}
+	}
+	if covered < len(shardPaths) {
+		logx.Infof("digest %s: read %d of %d chunks", session.Key(), len(shardPaths)-covered, len(shardPaths))
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// 从 offset 开始读取对象写入 h
+func readMd5(h hash.Hash, bucketname, objectname string, offset int64) error {
+	object, err := store.GetObject(bucketname, objectname, minio.GetObjectOptions{})
+	if err != nil {
+		return err
+	}
+	defer object.Close()
+	if offset > 0 {
+		if _, err := object.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
+	}
+	_, err = io.Copy(h, object)
+	return err
+}
@@ -0,0 +1,58 @@
+package common
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/minio/minio-go"
+)
+
+// 输出对象内容，由 http.ServeContent 处理 Range、条件请求和 Content-Length
+func serveObject(w http.ResponseWriter, r *http.Request, object StoreObject, stat minio.ObjectInfo, objectname string) {
+	contentType := stat.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	if etag := removeBackslashAndQuotes(stat.ETag); etag != "" {
+		w.Header().Set("ETag", `"`+etag+`"`)
+	}
+	if versionId := stat.Metadata.Get(headerVersionId); versionId != "" {
+		w.Header().Set(headerVersionId, versionId)
+	}
+	for k, v := range userMetadata(stat.Metadata) {
+		w.Header().Set("X-Amz-Meta-"+k, v)
+	}
+	w.Header().Set("Content-Disposition", contentDisposition("attachment", path.Base(objectname)))
+	http.ServeContent(w, r, "", stat.LastModified, object)
+}
+
+// 生成 Content-Disposition，filename 为 ASCII 兼容名，filename* 为 RFC 5987 编码的原始文件名
+func contentDisposition(dispositionType, filename string) string {
+	var ascii strings.Builder
+	for _, c := range filename {
+		if c < 0x20 || c > 0x7e || c == '"' || c == '\\' || c == '%' {
+			ascii.WriteByte('_')
+		} else {
+			ascii.WriteRune(c)
+		}
+	}
+	return fmt.Sprintf(`%s; filename="%s"; filename*=UTF-8''%s`, dispositionType, ascii.String(), rfc5987Escape(filename))
+}
+
+// RFC 5987 attr-char 以外的字节做百分号编码
+func rfc5987Escape(str string) string {
+	const attrChar = "!#$&+-.^_`|~"
+	var b strings.Builder
+	for i := 0; i < len(str); i++ {
+		c := str[i]
+		if ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') || strings.IndexByte(attrChar, c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,611 @@
+package common
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"minio_demo/errorx"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go"
+)
+
+// 接口返回的 json
+type testResponse struct {
+	Code errorx.Code     `json:"code"`
+	Msg  interface{}     `json:"msg"`
+	Data json.RawMessage `json:"data"`
+}
+
+// 使用内存存储，每个用例互不影响
+func setupTestStores(t *testing.T, buckets ...string) {
+	t.Helper()
+	SetObjectStore(NewMemoryStore())
+	SetMetadataStore(NewMemoryMetadataStore())
+	SetSessionStore(NewMemorySessionStore(time.Hour))
+	SetJanitorStore(NewMemoryJanitorStore())
+	for _, bucket := range buckets {
+		if err := store.MakeBucket(bucket, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func decodeResponse(t *testing.T, w *httptest.ResponseRecorder, data interface{}) testResponse {
+	t.Helper()
+	var res testResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatalf("decode %q: %v", w.Body.String(), err)
+	}
+	if data != nil && len(res.Data) > 0 {
+		if err := json.Unmarshal(res.Data, data); err != nil {
+			t.Fatalf("decode data %s: %v", res.Data, err)
+		}
+	}
+	return res
+}
+
+func md5Hex(data []byte) string {
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// multipart 表单请求，file 非 nil 时作为 file 字段上传
+func multipartRequest(method, target string, fields map[string]string, file []byte) *http.Request {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for k, v := range fields {
+		mw.WriteField(k, v)
+	}
+	if file != nil {
+		fw, _ := mw.CreateFormFile("file", "blob")
+		fw.Write(file)
+	}
+	mw.Close()
+	r := httptest.NewRequest(method, target, &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	return r
+}
+
+func formRequest(target string, values url.Values) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(values.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+func serve(h http.HandlerFunc, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h(w, r)
+	return w
+}
+
+// 上传 data 的第 chunkNumber 个分片
+func uploadChunk(bucket, identifier, filename string, data []byte, chunkSize, chunkNumber int, extra map[string]string) *httptest.ResponseRecorder {
+	totalChunks := (len(data) + chunkSize - 1) / chunkSize
+	end := chunkNumber * chunkSize
+	if end > len(data) {
+		end = len(data)
+	}
+	fields := map[string]string{
+		"BucketName":  bucket,
+		"identifier":  identifier,
+		"filename":    filename,
+		"chunkSize":   strconv.Itoa(chunkSize),
+		"totalSize":   strconv.Itoa(len(data)),
+		"totalChunks": strconv.Itoa(totalChunks),
+		"chunkNumber": strconv.Itoa(chunkNumber),
+	}
+	for k, v := range extra {
+		fields[k] = v
+	}
+	return serve(Upload, multipartRequest(http.MethodPost, "/upload", fields, data[(chunkNumber-1)*chunkSize:end]))
+}
+
+func readObject(t *testing.T, bucket, object string) string {
+	t.Helper()
+	o, err := store.GetObject(bucket, object, minio.GetObjectOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o.Close()
+	data, err := io.ReadAll(o)
+	if err != nil {
+		t.Fatalf("read %s/%s: %v", bucket, object, err)
+	}
+	return string(data)
+}
+
+func putTestObject(t *testing.T, bucket, object, content string, record bool) *FileSaveInfo {
+	t.Helper()
+	if _, err := store.PutObject(bucket, object, strings.NewReader(content), int64(len(content)), minio.PutObjectOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	info, err := GetStatObject(bucket, object)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info.Md5 = removeBackslashAndQuotes(info.Md5)
+	if record {
+		if err := metadata.Save(info.Md5, info); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return info
+}
+
+func TestChunkUpload(t *testing.T) {
+	data := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+	id := md5Hex(data)
+	tests := []struct {
+		name string
+		// 按顺序上传的分片编号
+		chunks []int
+		// 查询状态时已上传的分片
+		uploaded []int
+		merged   bool
+	}{
+		{name: "in order", chunks: []int{1, 2, 3, 4}, merged: true},
+		{name: "out of order", chunks: []int{4, 2, 1, 3}, merged: true},
+		{name: "resume", chunks: []int{1, 3}, uploaded: []int{1, 3}},
+		{name: "duplicate chunk", chunks: []int{2, 2, 1, 3, 4}, merged: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestStores(t, "bucket")
+			var res testResponse
+			var info FileSaveInfo
+			for _, n := range tt.chunks {
+				res = decodeResponse(t, uploadChunk("bucket", id, "a.txt", data, 10, n, nil), &info)
+				if res.Code != errorx.CodeSuccess {
+					t.Fatalf("chunk %d: code %d msg %v", n, res.Code, res.Msg)
+				}
+			}
+			if !tt.merged {
+				r := httptest.NewRequest(http.MethodGet, "/upload?BucketName=bucket&identifier="+id+"&chunkSize=10&totalChunks=4", nil)
+				var status UploadStatusInfo
+				decodeResponse(t, serve(Upload, r), &status)
+				if status.SkipUpload || len(status.Uploaded) != len(tt.uploaded) {
+					t.Fatalf("status %+v, want uploaded %v", status, tt.uploaded)
+				}
+				for i, n := range tt.uploaded {
+					if status.Uploaded[i] != n {
+						t.Fatalf("uploaded %v, want %v", status.Uploaded, tt.uploaded)
+					}
+				}
+				return
+			}
+			if info.ObjectName != "a.txt" || info.Md5 != id || info.Size != int64(len(data)) {
+				t.Fatalf("merged info %+v", info)
+			}
+			if got := readObject(t, "bucket", "a.txt"); got != string(data) {
+				t.Fatalf("merged content %q", got)
+			}
+			// 分片对象和会话在合并后删除
+			res2, err := store.ListObjectsV2("bucket", id+"_10/", "", "", 100)
+			if err != nil || len(res2.Contents) != 0 {
+				t.Fatalf("chunks left: %v %v", res2.Contents, err)
+			}
+			if list, _ := sessions.List(); len(list) != 0 {
+				t.Fatalf("sessions left: %d", len(list))
+			}
+		})
+	}
+}
+
+func TestInstantUpload(t *testing.T) {
+	data := []byte("instant upload content")
+	id := md5Hex(data)
+	tests := []struct {
+		name     string
+		bucket   string
+		filename string
+	}{
+		{name: "same name", bucket: "bucket", filename: "a.txt"},
+		{name: "other name", bucket: "bucket", filename: "b.txt"},
+		{name: "other bucket", bucket: "other", filename: "a.txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestStores(t, "bucket", "other")
+			if res := decodeResponse(t, uploadChunk("bucket", id, "a.txt", data, 100, 1, nil), nil); res.Code != errorx.CodeSuccess {
+				t.Fatalf("first upload: code %d", res.Code)
+			}
+
+			r := httptest.NewRequest(http.MethodGet, "/upload?BucketName="+tt.bucket+"&identifier="+id+"&chunkSize=100&totalChunks=1", nil)
+			var status UploadStatusInfo
+			decodeResponse(t, serve(Upload, r), &status)
+			if !status.SkipUpload || status.Info == nil || status.Info.ObjectName != "a.txt" {
+				t.Fatalf("status %+v", status)
+			}
+
+			var info FileSaveInfo
+			res := decodeResponse(t, uploadChunk(tt.bucket, id, tt.filename, data, 100, 1, nil), &info)
+			if res.Code != errorx.CodeSuccess || info.BucketName != "bucket" || info.ObjectName != "a.txt" {
+				t.Fatalf("instant upload: code %d info %+v", res.Code, info)
+			}
+			if tt.filename != "a.txt" {
+				if _, err := store.StatObject(tt.bucket, tt.filename, minio.StatObjectOptions{}); err == nil {
+					t.Fatal("instant upload wrote a new object")
+				}
+			}
+		})
+	}
+}
+
+func TestRangeDownload(t *testing.T) {
+	setupTestStores(t, "bucket")
+	putTestObject(t, "bucket", "dir/a.txt", "0123456789", false)
+	tests := []struct {
+		name   string
+		object string
+		rng    string
+		status int
+		body   string
+	}{
+		{name: "full", object: "dir/a.txt", status: http.StatusOK, body: "0123456789"},
+		{name: "range", object: "dir/a.txt", rng: "bytes=2-4", status: http.StatusPartialContent, body: "234"},
+		{name: "open range", object: "dir/a.txt", rng: "bytes=7-", status: http.StatusPartialContent, body: "789"},
+		{name: "suffix range", object: "dir/a.txt", rng: "bytes=-3", status: http.StatusPartialContent, body: "789"},
+		{name: "unsatisfiable", object: "dir/a.txt", rng: "bytes=20-30", status: http.StatusRequestedRangeNotSatisfiable},
+		{name: "not found", object: "dir/b.txt", status: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/download?bucket_name=bucket&object_name="+url.QueryEscape(tt.object), nil)
+			if tt.rng != "" {
+				r.Header.Set("Range", tt.rng)
+			}
+			w := serve(DownLoad, r)
+			if w.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+			if tt.body != "" && w.Body.String() != tt.body {
+				t.Fatalf("body %q, want %q", w.Body.String(), tt.body)
+			}
+		})
+	}
+}
+
+func TestListPagination(t *testing.T) {
+	setupTestStores(t, "bucket")
+	keys := []string{"a.txt", "b.txt", "d/1.txt", "d/2.txt", "e/x/1.txt", "f.txt", "g.txt"}
+	for i, key := range keys {
+		putTestObject(t, "bucket", key, strings.Repeat("x", i+1), false)
+	}
+	tests := []struct {
+		name     string
+		query    string
+		keys     []string
+		prefixes []string
+		pages    int
+	}{
+		{name: "flat", query: "max_keys=2", keys: keys, pages: 4},
+		{name: "delimiter", query: "delimiter=/&max_keys=2", keys: []string{"a.txt", "b.txt", "f.txt", "g.txt"}, prefixes: []string{"d/", "e/"}, pages: 3},
+		{name: "prefix", query: "prefix=d/&max_keys=1", keys: []string{"d/1.txt", "d/2.txt"}, pages: 2},
+		// 最后一页被过滤为空
+		{name: "size filter", query: "min_size=3&max_size=6&max_keys=2", keys: []string{"d/1.txt", "d/2.txt", "e/x/1.txt", "f.txt"}, pages: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotKeys, gotPrefixes []string
+			token, pages := "", 0
+			for {
+				target := "/api/v1/buckets/bucket/objects?" + tt.query
+				if token != "" {
+					target += "&continuation_token=" + url.QueryEscape(token)
+				}
+				w := serve(RestV1, httptest.NewRequest(http.MethodGet, target, nil))
+				var list ObjectList
+				if res := decodeResponse(t, w, &list); res.Code != errorx.CodeSuccess {
+					t.Fatalf("list: code %d msg %v", res.Code, res.Msg)
+				}
+				pages++
+				for _, o := range list.Objects {
+					gotKeys = append(gotKeys, o.ObjectName)
+				}
+				gotPrefixes = append(gotPrefixes, list.Prefixes...)
+				if !list.IsTruncated {
+					break
+				}
+				if list.NextContinuationToken == "" || pages > len(keys) {
+					t.Fatalf("truncated page %d without usable token", pages)
+				}
+				token = list.NextContinuationToken
+			}
+			if strings.Join(gotKeys, ",") != strings.Join(tt.keys, ",") {
+				t.Fatalf("keys %v, want %v", gotKeys, tt.keys)
+			}
+			if strings.Join(gotPrefixes, ",") != strings.Join(tt.prefixes, ",") {
+				t.Fatalf("prefixes %v, want %v", gotPrefixes, tt.prefixes)
+			}
+			if pages != tt.pages {
+				t.Fatalf("pages %d, want %d", pages, tt.pages)
+			}
+		})
+	}
+
+	// 排序只能用于单页
+	w := serve(RestV1, httptest.NewRequest(http.MethodGet, "/api/v1/buckets/bucket/objects?sort_by=size&continuation_token=abc", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("sort with token: status %d", w.Code)
+	}
+}
+
+func TestQuota(t *testing.T) {
+	tests := []struct {
+		name string
+		// 已写入的对象大小
+		used int
+		do   func(t *testing.T) errorx.Code
+		want errorx.Code
+	}{
+		{
+			name: "rest put within quota",
+			do: func(t *testing.T) errorx.Code {
+				return decodeResponse(t, serve(RestV1, httptest.NewRequest(http.MethodPut, "/api/v1/buckets/bucket/objects/x", strings.NewReader("1234"))), nil).Code
+			},
+			want: errorx.CodeSuccess,
+		},
+		{
+			name: "rest put over quota",
+			used: 8,
+			do: func(t *testing.T) errorx.Code {
+				return decodeResponse(t, serve(RestV1, httptest.NewRequest(http.MethodPut, "/api/v1/buckets/bucket/objects/x", strings.NewReader("1234"))), nil).Code
+			},
+			want: errorx.CodeQuotaExceeded,
+		},
+		{
+			name: "chunk upload over quota",
+			used: 8,
+			do: func(t *testing.T) errorx.Code {
+				data := []byte("1234")
+				return decodeResponse(t, uploadChunk("bucket", md5Hex(data), "c.txt", data, 4, 1, nil), nil).Code
+			},
+			want: errorx.CodeQuotaExceeded,
+		},
+		{
+			name: "multipart initiate over quota",
+			do: func(t *testing.T) errorx.Code {
+				r := formRequest("/multipart/initiate", url.Values{"bucket_name": {"bucket"}, "object_name": {"big"}, "total_size": {"11"}})
+				return decodeResponse(t, serve(InitiateMultipartUpload, r), nil).Code
+			},
+			want: errorx.CodeQuotaExceeded,
+		},
+		{
+			name: "copy over quota",
+			used: 8,
+			do: func(t *testing.T) errorx.Code {
+				putTestObject(t, "other", "src", "1234", false)
+				r := formRequest("/copy_object", url.Values{"src_bucket": {"other"}, "src_object": {"src"}, "dst_bucket": {"bucket"}})
+				return decodeResponse(t, serve(CopyObject, r), nil).Code
+			},
+			want: errorx.CodeQuotaExceeded,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestStores(t, "other")
+			w := serve(RestV1, httptest.NewRequest(http.MethodPut, "/api/v1/buckets/bucket?quota=10", nil))
+			if w.Code != http.StatusCreated {
+				t.Fatalf("create bucket: %d %s", w.Code, w.Body.String())
+			}
+			if tt.used > 0 {
+				putTestObject(t, "bucket", "used", strings.Repeat("x", tt.used), false)
+			}
+			if code := tt.do(t); code != tt.want {
+				t.Fatalf("code %d, want %d", code, tt.want)
+			}
+			used, err := metadata.GetBucketUsage("bucket")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := int64(tt.used); tt.want == errorx.CodeQuotaExceeded && used != want {
+				t.Fatalf("usage %d after rejection, want %d", used, want)
+			}
+		})
+	}
+}
+
+func TestChecksumMismatch(t *testing.T) {
+	data := []byte("checksum content")
+	wrongMd5 := md5Hex([]byte("other content"))
+	tests := []struct {
+		name   string
+		do     func(t *testing.T) *httptest.ResponseRecorder
+		status int
+		want   errorx.Code
+		// 校验失败后不应存在的对象
+		object string
+	}{
+		{
+			name: "rest put content-md5",
+			do: func(t *testing.T) *httptest.ResponseRecorder {
+				r := httptest.NewRequest(http.MethodPut, "/api/v1/buckets/bucket/objects/a.txt", bytes.NewReader(data))
+				r.Header.Set("Content-MD5", wrongMd5)
+				return serve(RestV1, r)
+			},
+			status: http.StatusBadRequest,
+			want:   errorx.CodeChecksumMismatch,
+			object: "a.txt",
+		},
+		{
+			name: "rest put sha256",
+			do: func(t *testing.T) *httptest.ResponseRecorder {
+				r := httptest.NewRequest(http.MethodPut, "/api/v1/buckets/bucket/objects/a.txt", bytes.NewReader(data))
+				r.Header.Set("X-Amz-Checksum-Sha256", strings.Repeat("00", 32))
+				return serve(RestV1, r)
+			},
+			status: http.StatusBadRequest,
+			want:   errorx.CodeChecksumMismatch,
+			object: "a.txt",
+		},
+		{
+			name: "chunk checksum",
+			do: func(t *testing.T) *httptest.ResponseRecorder {
+				return uploadChunk("bucket", md5Hex(data), "a.txt", data, 8, 1, map[string]string{"checksum": wrongMd5})
+			},
+			status: http.StatusOK,
+			want:   errorx.CodeChunkChecksumMismatch,
+			object: md5Hex(data) + "_8/1.part",
+		},
+		{
+			name: "merged file md5",
+			do: func(t *testing.T) *httptest.ResponseRecorder {
+				uploadChunk("bucket", wrongMd5, "a.txt", data, 8, 1, nil)
+				return uploadChunk("bucket", wrongMd5, "a.txt", data, 8, 2, nil)
+			},
+			status: http.StatusOK,
+			want:   errorx.CodeChecksumMismatch,
+			object: "a.txt",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestStores(t, "bucket")
+			w := tt.do(t)
+			if w.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.status, w.Body.String())
+			}
+			if res := decodeResponse(t, w, nil); res.Code != tt.want {
+				t.Fatalf("code %d, want %d", res.Code, tt.want)
+			}
+			if _, err := store.StatObject("bucket", tt.object, minio.StatObjectOptions{}); err == nil {
+				t.Fatalf("object %s was written", tt.object)
+			}
+			if _, err := metadata.GetByMd5(wrongMd5); err == nil {
+				t.Fatal("md5 index was written")
+			}
+		})
+	}
+}
+
+func TestCopyAndMove(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		values  url.Values
+		dst     string
+		// 源对象是否保留
+		keepSrc bool
+		want    errorx.Code
+	}{
+		{name: "copy same bucket", handler: CopyObject, values: url.Values{"dst_object": {"b.txt"}}, dst: "src/b.txt", keepSrc: true},
+		{name: "copy other bucket", handler: CopyObject, values: url.Values{"dst_bucket": {"dst"}}, dst: "dst/a.txt", keepSrc: true},
+		{name: "move same bucket", handler: MoveObject, values: url.Values{"dst_object": {"b.txt"}}, dst: "src/b.txt"},
+		{name: "move other bucket", handler: MoveObject, values: url.Values{"dst_bucket": {"dst"}, "dst_object": {"c.txt"}}, dst: "dst/c.txt"},
+		{name: "copy to itself", handler: CopyObject, values: url.Values{}, want: errorx.CodeInternalParamsError, keepSrc: true},
+		{name: "missing dst bucket", handler: MoveObject, values: url.Values{"dst_bucket": {"none"}}, want: errorx.CodeBucketNotFound, keepSrc: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestStores(t, "src", "dst")
+			src := putTestObject(t, "src", "a.txt", "copy me", true)
+			values := url.Values{"src_bucket": {"src"}, "src_object": {"a.txt"}}
+			for k, v := range tt.values {
+				values[k] = v
+			}
+			var info FileSaveInfo
+			res := decodeResponse(t, serve(tt.handler, formRequest("/copy_object", values)), &info)
+			want := tt.want
+			if want == 0 {
+				want = errorx.CodeSuccess
+			}
+			if res.Code != want {
+				t.Fatalf("code %d, want %d: %v", res.Code, want, res.Msg)
+			}
+			if _, err := metadata.GetByName("src", "a.txt"); (err == nil) != tt.keepSrc {
+				t.Fatalf("source record kept: %v, want %v", err == nil, tt.keepSrc)
+			}
+			if _, err := store.StatObject("src", "a.txt", minio.StatObjectOptions{}); (err == nil) != tt.keepSrc {
+				t.Fatalf("source object kept: %v, want %v", err == nil, tt.keepSrc)
+			}
+			if tt.dst == "" {
+				return
+			}
+			bucket, object := tt.dst[:strings.Index(tt.dst, "/")], tt.dst[strings.Index(tt.dst, "/")+1:]
+			if info.BucketName != bucket || info.ObjectName != object || info.Md5 != src.Md5 {
+				t.Fatalf("info %+v", info)
+			}
+			if got := readObject(t, bucket, object); got != "copy me" {
+				t.Fatalf("content %q", got)
+			}
+			if _, err := metadata.GetByName(bucket, object); err != nil {
+				t.Fatalf("destination record: %v", err)
+			}
+			// 移动后md5索引指向新位置，复制不改变索引
+			indexed, err := metadata.GetByMd5(src.Md5)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.keepSrc && (indexed.BucketName != "src" || indexed.ObjectName != "a.txt") {
+				t.Fatalf("copy moved md5 index to %s/%s", indexed.BucketName, indexed.ObjectName)
+			}
+			if !tt.keepSrc && (indexed.BucketName != bucket || indexed.ObjectName != object) {
+				t.Fatalf("md5 index %s/%s, want %s", indexed.BucketName, indexed.ObjectName, tt.dst)
+			}
+		})
+	}
+}
+
+func TestJanitor(t *testing.T) {
+	setupTestStores(t, "bucket")
+	data := []byte("stale chunk upload")
+	id := md5Hex(data)
+	uploadChunk("bucket", id, "stale.txt", data, 8, 1, nil)
+	putTestObject(t, "bucket", "orphan_8/1.part", "x", false)
+	putTestObject(t, "bucket", stagingPrefix+"token", "x", false)
+	putTestObject(t, "bucket", "keep.txt", "keep", true)
+	gone := putTestObject(t, "bucket", "gone.txt", "gone", true)
+	if err := store.RemoveObject("bucket", "gone.txt"); err != nil {
+		t.Fatal(err)
+	}
+	metadata.Save("", &FileSaveInfo{BucketName: "removed", ObjectName: "x"})
+
+	stats := runJanitor(0)
+	if stats == nil {
+		t.Fatal("janitor skipped")
+	}
+	// 会话和分片尚未过期，只清理记录，删除文件记录时一并删除md5索引
+	if stats.StaleSessions != 0 || stats.RemovedRecords != 1 || stats.RemovedMd5 != 0 || stats.RemovedBuckets != 1 || stats.Errors != 0 {
+		t.Fatalf("stats %+v", stats)
+	}
+	if runJanitor(time.Hour) != nil {
+		t.Fatal("janitor ran again within minGap")
+	}
+	if _, err := metadata.GetByMd5(gone.Md5); err == nil {
+		t.Fatal("md5 index of removed object kept")
+	}
+	if _, err := metadata.GetByName("bucket", "keep.txt"); err != nil {
+		t.Fatalf("record of existing object removed: %v", err)
+	}
+
+	var last JanitorStats
+	if res := decodeResponse(t, serve(GetJanitorStats, httptest.NewRequest(http.MethodGet, "/janitor_stats", nil)), &last); res.Code != errorx.CodeSuccess || last.StartedAt != stats.StartedAt {
+		t.Fatalf("janitor stats: code %d %+v", res.Code, last)
+	}
+
+	// 截止时间之后，过期会话的分片和残留对象全部删除
+	cutoff := time.Now().Add(time.Hour)
+	stats = &JanitorStats{}
+	cleanStaleSessions(stats, cutoff)
+	sweepOrphanedObjects(stats, cutoff)
+	if stats.StaleSessions != 1 || stats.RemovedChunks != 1 || stats.OrphanedObjects != 2 || stats.Errors != 0 {
+		t.Fatalf("stats %+v", stats)
+	}
+	res, err := store.ListObjectsV2("bucket", "", "", "", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Contents) != 1 || res.Contents[0].Key != "keep.txt" {
+		t.Fatalf("objects left: %v", res.Contents)
+	}
+}
@@ -0,0 +1,431 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"minio_demo/config"
+	"minio_demo/errorx"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/minio/minio-go"
+	"github.com/zituocn/logx"
+)
+
+// 清理任务默认配置
+const (
+	defaultJanitorInterval = time.Hour
+	defaultSessionMaxAge   = 12 * time.Hour
+	// 执行锁过期时间，执行期间每 1/3 过期时间续期一次
+	janitorLockTTL = time.Minute
+)
+
+// 最近一次清理的统计
+type JanitorStats struct {
+	// 执行清理的实例，主机名:进程号
+	Instance   string `json:"instance"`
+	StartedAt  string `json:"startedAt"`
+	FinishedAt string `json:"finishedAt"`
+	DurationMs int64  `json:"durationMs"`
+	// 清理的过期分片会话和删除的分片对象
+	StaleSessions int `json:"staleSessions"`
+	RemovedChunks int `json:"removedChunks"`
+	FailedChunks  int `json:"failedChunks"`
+	// 会话已过期或丢失后残留的分片对象和暂存对象
+	OrphanedObjects int `json:"orphanedObjects"`
+	// 删除的文件记录(桶名+文件名索引)和md5索引，对应的对象已不存在
+	RemovedRecords int `json:"removedRecords"`
+	RemovedMd5     int `json:"removedMd5"`
+	// 桶已不存在，删除了全部文件记录、配额和已用容量
+	RemovedBuckets int    `json:"removedBuckets"`
+	Errors         int    `json:"errors"`
+	LastError      string `json:"lastError,omitempty"`
+}
+
+func (m *JanitorStats) MarshalBinary() (data []byte, err error) {
+	return json.Marshal(m)
+}
+
+func (m *JanitorStats) UnmarshalBinary(data []byte) error {
+	return json.Unmarshal(data, m)
+}
+
+func (m *JanitorStats) fail(err error) {
+	m.Errors++
+	m.LastError = err.Error()
+}
+
+// 清理任务的执行锁和统计，多个实例共享
+type JanitorStore interface {
+	// 获取执行锁，未获得时返回空 token，ttl 内未续期时锁过期
+	AcquireRun(ttl time.Duration) (string, error)
+	// 续期执行锁，锁已过期或被其他实例持有时返回 false
+	RenewRun(token string, ttl time.Duration) (bool, error)
+	// 释放执行锁，只删除 token 一致的锁
+	ReleaseRun(token string) error
+	SaveStats(stats *JanitorStats) error
+	// 从未执行过时返回 nil
+	LastStats() (*JanitorStats, error)
+}
+
+var janitors JanitorStore
+
+// 注入清理任务存储实现
+func SetJanitorStore(s JanitorStore) {
+	janitors = s
+}
+
+func janitorInterval() time.Duration {
+	interval := time.Duration(config.ConfData.Janitor.Interval) * time.Second
+	if interval <= 0 {
+		return defaultJanitorInterval
+	}
+	return interval
+}
+
+func sessionMaxAge() time.Duration {
+	maxAge := time.Duration(config.ConfData.Janitor.SessionMaxAge) * time.Second
+	if maxAge <= 0 {
+		return defaultSessionMaxAge
+	}
+	return maxAge
+}
+
+// 启动后台清理任务，每个执行间隔内只有一个实例执行
+func InitJanitor() {
+	if !config.ConfData.Janitor.Enabled {
+		return
+	}
+	interval := janitorInterval()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			// 间隔提前 1/10，避免计时误差导致下一个间隔被跳过
+			runJanitor(interval - interval/10)
+		}
+	}()
+}
+
+// 获得执行锁后清理过期分片会话和无效文件记录，
+// 未获得锁或 minGap 内已有实例执行过时返回 nil
+func runJanitor(minGap time.Duration) *JanitorStats {
+	token, err := janitors.AcquireRun(janitorLockTTL)
+	if err != nil {
+		logx.Errorf("janitor AcquireRun %v", err)
+		return nil
+	}
+	if token == "" {
+		logx.Info("janitor skipped: running on another instance")
+		return nil
+	}
+	defer func() {
+		if err := janitors.ReleaseRun(token); err != nil {
+			logx.Errorf("janitor ReleaseRun %v", err)
+		}
+	}()
+	if last, err := janitors.LastStats(); err != nil {
+		logx.Errorf("janitor LastStats %v", err)
+		return nil
+	} else if last != nil {
+		started, err := time.ParseInLocation("2006-01-02 15:04:05", last.StartedAt, time.Local)
+		if err == nil && time.Since(started) < minGap {
+			logx.Info("janitor skipped: finished on another instance")
+			return nil
+		}
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go renewJanitorLock(token, done)
+
+	start := time.Now()
+	hostname, _ := os.Hostname()
+	stats := &JanitorStats{
+		Instance:  hostname + ":" + strconv.Itoa(os.Getpid()),
+		StartedAt: start.Format("2006-01-02 15:04:05"),
+	}
+	cleanStaleSessions(stats, start.Add(-sessionMaxAge()))
+	sweepOrphanedObjects(stats, start.Add(-sessionMaxAge()))
+	reconcileMetadata(stats)
+	reconcileUsage(stats)
+	finish := time.Now()
+	stats.FinishedAt = finish.Format("2006-01-02 15:04:05")
+	stats.DurationMs = finish.Sub(start).Milliseconds()
+	logx.Infof("janitor finished: sessions:%d chunks:%d orphans:%d records:%d md5:%d buckets:%d errors:%d",
+		stats.StaleSessions, stats.RemovedChunks, stats.OrphanedObjects, stats.RemovedRecords, stats.RemovedMd5, stats.RemovedBuckets, stats.Errors)
+	if err := janitors.SaveStats(stats); err != nil {
+		logx.Errorf("janitor SaveStats %v", err)
+	}
+	return stats
+}
+
+// 执行期间续期执行锁，锁丢失时只记录日志，本次执行继续完成
+func renewJanitorLock(token string, done <-chan struct{}) {
+	ticker := time.NewTicker(janitorLockTTL / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			ok, err := janitors.RenewRun(token, janitorLockTTL)
+			if err != nil {
+				logx.Errorf("janitor RenewRun %v", err)
+			} else if !ok {
+				logx.Warn("janitor lock lost, another instance may start")
+			}
+		}
+	}
+}
+
+// 清理 before 之前最后更新的分片会话，正在合并的会话跳过
+func cleanStaleSessions(stats *JanitorStats, before time.Time) {
+	list, err := sessions.List()
+	if err != nil {
+		logx.Error("sessions.List error:", err.Error())
+		stats.fail(err)
+		return
+	}
+	for _, session := range list {
+		if time.Unix(session.UpdatedAt, 0).After(before) {
+			continue
+		}
+		key := session.Key()
+		token, err := sessions.AcquireMerge(key)
+		if err != nil || token == "" {
+			continue
+		}
+		var removed, failed int
+		if session.UploadId != "" {
+			// 分段上传的会话：取消上传，上传已完成或已取消时视为成功
+			err = store.AbortMultipartUpload(session.BucketName, session.Filename, session.UploadId)
+			if code := minio.ToErrorResponse(err).Code; code == "NoSuchUpload" || code == "NoSuchBucket" {
+				err = nil
+			}
+		} else {
+			removed, failed, err = removeChunkObjects(session.BucketName, key)
+		}
+		stats.RemovedChunks += removed
+		stats.FailedChunks += failed
+		if err != nil {
+			logx.Errorf("janitor session:%s remove chunks %v", key, err)
+			stats.fail(err)
+		}
+		// 分片未全部删除时保留会话，下次继续清理
+		if err != nil || failed > 0 {
+			sessions.ReleaseMerge(key, token)
+			continue
+		}
+		if err := sessions.Delete(key); err != nil {
+			stats.fail(err)
+			continue
+		}
+		stats.StaleSessions++
+	}
+}
+
+// 删除会话的全部分片对象，桶已删除时视为删除成功
+func removeChunkObjects(bucketname, key string) (removed, failed int, err error) {
+	doneCh := make(chan struct{})
+	defer close(doneCh)
+	names := make([]string, 0)
+	for object := range store.ListObjects(bucketname, key+"/", true, doneCh) {
+		if object.Err != nil {
+			if errorx.From(object.Err).Code == errorx.CodeBucketNotFound {
+				return 0, 0, nil
+			}
+			return 0, 0, object.Err
+		}
+		if _, ok := parseChunkNumber(object.Key); ok {
+			names = append(names, object.Key)
+		}
+	}
+	if len(names) == 0 {
+		return 0, 0, nil
+	}
+	fails := removeObjects(bucketname, names)
+	return len(names) - len(fails), len(fails), nil
+}
+
+// 分片对象的目录，与 sessionKey 一致：<identifier>_<chunkSize>/
+var chunkDirRegexp = regexp.MustCompile(`^.+_[0-9]+/$`)
+
+// 删除 before 之前写入、没有对应会话的分片对象和暂存对象
+// 会话在 Redis 中过期后 cleanStaleSessions 无法找到它的分片，按前缀扫描清理
+func sweepOrphanedObjects(stats *JanitorStats, before time.Time) {
+	list, err := sessions.List()
+	if err != nil {
+		logx.Error("sessions.List error:", err.Error())
+		stats.fail(err)
+		return
+	}
+	active := make(map[string]bool, len(list))
+	for _, session := range list {
+		active[session.Key()+"/"] = true
+	}
+	buckets, err := store.ListBuckets()
+	if err != nil {
+		logx.Errorf("janitor ListBuckets %v", err)
+		stats.fail(err)
+		return
+	}
+	for _, bucket := range buckets {
+		dirs := []string{stagingPrefix}
+		doneCh := make(chan struct{})
+		for object := range store.ListObjects(bucket.Name, "", false, doneCh) {
+			if object.Err != nil {
+				stats.fail(fmt.Errorf("list %s: %v", bucket.Name, object.Err))
+				dirs = dirs[:0]
+				break
+			}
+			if chunkDirRegexp.MatchString(object.Key) && !active[object.Key] {
+				dirs = append(dirs, object.Key)
+			}
+		}
+		close(doneCh)
+		for _, dir := range dirs {
+			sweepPrefix(bucket.Name, dir, before, stats)
+		}
+	}
+}
+
+// 删除前缀下 before 之前写入的对象，分片目录只删除分片对象
+func sweepPrefix(bucketname, prefix string, before time.Time, stats *JanitorStats) {
+	doneCh := make(chan struct{})
+	defer close(doneCh)
+	names := make([]string, 0)
+	for object := range store.ListObjects(bucketname, prefix, true, doneCh) {
+		if object.Err != nil {
+			stats.fail(fmt.Errorf("list %s/%s: %v", bucketname, prefix, object.Err))
+			return
+		}
+		if !object.LastModified.Before(before) {
+			continue
+		}
+		if _, ok := parseChunkNumber(object.Key); ok || prefix == stagingPrefix {
+			names = append(names, object.Key)
+		}
+	}
+	if len(names) == 0 {
+		return
+	}
+	fails := removeObjects(bucketname, names)
+	stats.OrphanedObjects += len(names) - len(fails)
+	if len(fails) > 0 {
+		stats.fail(fmt.Errorf("remove %d orphaned objects in %s/%s", len(fails), bucketname, prefix))
+	}
+}
+
+// 删除对象已不存在的文件记录和md5索引，桶已不存在时删除桶的全部记录
+// 遍历文件记录存储中的桶，绕过本服务删除的桶也能清理
+func reconcileMetadata(stats *JanitorStats) {
+	buckets, err := metadata.ListBuckets()
+	if err != nil {
+		logx.Errorf("janitor metadata ListBuckets %v", err)
+		stats.fail(err)
+		return
+	}
+	for _, bucketname := range buckets {
+		isExist, err := store.BucketExists(bucketname)
+		if err != nil {
+			stats.fail(fmt.Errorf("bucket exists %s: %v", bucketname, err))
+			continue
+		}
+		if !isExist {
+			if err := metadata.DeleteBucket(bucketname); err != nil {
+				logx.Error("metadata DeleteBucket error:", err.Error())
+				stats.fail(err)
+				continue
+			}
+			stats.RemovedBuckets++
+			continue
+		}
+		list, err := metadata.List(bucketname)
+		if err != nil {
+			stats.fail(err)
+			continue
+		}
+		for _, info := range list {
+			if removeStaleRecord(info, stats) {
+				stats.RemovedRecords++
+			}
+		}
+	}
+
+	md5s, err := metadata.ListMd5()
+	if err != nil {
+		logx.Errorf("janitor ListMd5 %v", err)
+		stats.fail(err)
+		return
+	}
+	for md5, info := range md5s {
+		info.Md5 = md5
+		if removeStaleRecord(info, stats) {
+			stats.RemovedMd5++
+		}
+	}
+}
+
+// 对象或记录的版本已不存在时删除记录，其他错误不删除
+func removeStaleRecord(info *FileSaveInfo, stats *JanitorStats) bool {
+	_, err := store.StatObjectVersion(info.BucketName, info.ObjectName, info.VersionId)
+	if err == nil {
+		return false
+	}
+	switch errorx.From(err).Code {
+	case errorx.CodeObjectNotFound, errorx.CodeVersionNotFound, errorx.CodeBucketNotFound:
+	default:
+		stats.fail(fmt.Errorf("stat %s/%s: %v", info.BucketName, info.ObjectName, err))
+		return false
+	}
+	if err := metadata.DeleteVersion(info); err != nil {
+		logx.Error("metadata DeleteVersion error:", err.Error())
+		stats.fail(err)
+		return false
+	}
+	return true
+}
+
+// 重新统计设置了配额的桶的已用容量，修正生命周期过期等未经过本服务的变更
+func reconcileUsage(stats *JanitorStats) {
+	buckets, err := store.ListBuckets()
+	if err != nil {
+		logx.Errorf("janitor ListBuckets %v", err)
+		stats.fail(err)
+		return
+	}
+	for _, bucket := range buckets {
+		quota, err := metadata.GetBucketQuota(bucket.Name)
+		if err != nil {
+			stats.fail(err)
+			continue
+		}
+		if quota <= 0 {
+			continue
+		}
+		used, err := countBucketUsage(bucket.Name)
+		if err != nil {
+			stats.fail(fmt.Errorf("count usage %s: %v", bucket.Name, err))
+			continue
+		}
+		if err := metadata.SetBucketUsage(bucket.Name, used); err != nil {
+			stats.fail(err)
+		}
+	}
+}
+
+// 查询最近一次清理的统计
+func GetJanitorStats(w http.ResponseWriter, r *http.Request) {
+	if !checkPermission(w, r, "", ActionAdmin) {
+		return
+	}
+	stats, err := janitors.LastStats()
+	if err != nil {
+		errorx.WriteOk(w, r, err)
+		return
+	}
+	errorx.Ok(w, r, stats)
+}
@@ -0,0 +1,70 @@
+package common
+
+import (
+	"sync"
+	"time"
+)
+
+// 进程内存实现，仅适用于单实例部署
+type memoryJanitorStore struct {
+	mu       sync.Mutex
+	token    string
+	lockedTo time.Time
+	stats    *JanitorStats
+}
+
+func NewMemoryJanitorStore() JanitorStore {
+	return &memoryJanitorStore{}
+}
+
+func (s *memoryJanitorStore) AcquireRun(ttl time.Duration) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != "" && time.Now().Before(s.lockedTo) {
+		return "", nil
+	}
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	s.token = token
+	s.lockedTo = time.Now().Add(ttl)
+	return token, nil
+}
+
+func (s *memoryJanitorStore) RenewRun(token string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != token || !time.Now().Before(s.lockedTo) {
+		return false, nil
+	}
+	s.lockedTo = time.Now().Add(ttl)
+	return true, nil
+}
+
+func (s *memoryJanitorStore) ReleaseRun(token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token == token {
+		s.token = ""
+	}
+	return nil
+}
+
+func (s *memoryJanitorStore) SaveStats(stats *JanitorStats) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v := *stats
+	s.stats = &v
+	return nil
+}
+
+func (s *memoryJanitorStore) LastStats() (*JanitorStats, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stats == nil {
+		return nil, nil
+	}
+	v := *s.stats
+	return &v, nil
+}
@@ -0,0 +1,72 @@
+package common
+
+import (
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// Redis 实现
+// key 规划：
+//
+//	minio_demo:janitor:lock   string  执行锁，value 为持有者的 token，执行期间定时续期
+//	minio_demo:janitor:stats  string  最近一次执行的统计(json)
+type redisJanitorStore struct {
+	db *redis.Client
+}
+
+func NewRedisJanitorStore(db *redis.Client) JanitorStore {
+	return &redisJanitorStore{db: db}
+}
+
+func (s *redisJanitorStore) lockKey() string {
+	return "minio_demo:janitor:lock"
+}
+
+func (s *redisJanitorStore) statsKey() string {
+	return "minio_demo:janitor:stats"
+}
+
+// 锁仍由 token 持有时续期
+var redisRenewScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("pexpire", KEYS[1], ARGV[2])
+end
+return 0`)
+
+func (s *redisJanitorStore) AcquireRun(ttl time.Duration) (string, error) {
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	ok, err := s.db.SetNX(s.lockKey(), token, ttl).Result()
+	if err != nil || !ok {
+		return "", err
+	}
+	return token, nil
+}
+
+func (s *redisJanitorStore) RenewRun(token string, ttl time.Duration) (bool, error) {
+	n, err := redisRenewScript.Run(s.db, []string{s.lockKey()}, token, ttl.Milliseconds()).Int64()
+	return n == 1, err
+}
+
+func (s *redisJanitorStore) ReleaseRun(token string) error {
+	return redisReleaseScript.Run(s.db, []string{s.lockKey()}, token).Err()
+}
+
+func (s *redisJanitorStore) SaveStats(stats *JanitorStats) error {
+	return s.db.Set(s.statsKey(), stats, 0).Err()
+}
+
+func (s *redisJanitorStore) LastStats() (*JanitorStats, error) {
+	stats := &JanitorStats{}
+	err := s.db.Get(s.statsKey()).Scan(stats)
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
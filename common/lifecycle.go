@@ -0,0 +1,421 @@
+package common
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"minio_demo/config"
+	"minio_demo/errorx"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go"
+	"github.com/zituocn/logx"
+)
+
+// S3 生命周期配置限制
+const (
+	maxLifecycleRules  = 1000
+	maxLifecycleRuleId = 255
+	maxLifecycleBody   = 1 << 20
+)
+
+// 服务安装的默认规则，上传的分片对象带有 chunkTagKey 标签，超过天数未合并时由存储端删除
+const (
+	chunkRuleId            = "minio-demo-expire-chunks"
+	chunkTagKey            = "minio-demo-chunk"
+	chunkTagValue          = "true"
+	defaultChunkExpireDays = 7
+)
+
+const lifecycleDateLayout = "2006-01-02"
+
+// 生命周期规则，过滤条件为前缀和标签，同时指定时需全部满足
+type LifecycleRule struct {
+	ID string `json:"id"`
+	// Enabled(默认) 或 Disabled
+	Status string            `json:"status"`
+	Prefix string            `json:"prefix,omitempty"`
+	Tags   map[string]string `json:"tags,omitempty"`
+	// 对象创建后的过期天数或过期日期(2006-01-02)，开启版本控制时过期会添加删除标记
+	ExpirationDays int    `json:"expirationDays,omitempty"`
+	ExpirationDate string `json:"expirationDate,omitempty"`
+	// 版本成为历史版本后的过期天数
+	NoncurrentVersionExpirationDays int `json:"noncurrentVersionExpirationDays,omitempty"`
+	// 未完成的分段上传在初始化后的过期天数，不能与标签同时使用
+	AbortIncompleteUploadDays int `json:"abortIncompleteUploadDays,omitempty"`
+}
+
+type BucketLifecycle struct {
+	Rules []*LifecycleRule `json:"rules"`
+}
+
+type lifecycleConfiguration struct {
+	XMLName xml.Name        `xml:"LifecycleConfiguration"`
+	Rules   []lifecycleRule `xml:"Rule"`
+}
+
+type lifecycleRule struct {
+	ID     string `xml:"ID,omitempty"`
+	Status string `xml:"Status"`
+	// 旧版本配置的前缀不在 Filter 中
+	Prefix                         *string                         `xml:"Prefix,omitempty"`
+	Filter                         *lifecycleFilter                `xml:"Filter,omitempty"`
+	Expiration                     *lifecycleExpiration            `xml:"Expiration,omitempty"`
+	NoncurrentVersionExpiration    *noncurrentVersionExpiration    `xml:"NoncurrentVersionExpiration,omitempty"`
+	AbortIncompleteMultipartUpload *abortIncompleteMultipartUpload `xml:"AbortIncompleteMultipartUpload,omitempty"`
+	// 不支持的配置(如 Transition)，安装默认规则时原样保留
+	Other []xmlElement `xml:",any"`
+}
+
+type xmlElement struct {
+	XMLName xml.Name
+	Inner   string `xml:",innerxml"`
+}
+
+type lifecycleFilter struct {
+	Prefix *string       `xml:"Prefix,omitempty"`
+	Tag    *tag          `xml:"Tag,omitempty"`
+	And    *lifecycleAnd `xml:"And,omitempty"`
+}
+
+type lifecycleAnd struct {
+	Prefix string `xml:"Prefix,omitempty"`
+	Tags   []tag  `xml:"Tag"`
+}
+
+type lifecycleExpiration struct {
+	Days int    `xml:"Days,omitempty"`
+	Date string `xml:"Date,omitempty"`
+}
+
+type noncurrentVersionExpiration struct {
+	NoncurrentDays int `xml:"NoncurrentDays"`
+}
+
+type abortIncompleteMultipartUpload struct {
+	DaysAfterInitiation int `xml:"DaysAfterInitiation"`
+}
+
+// 分片过期天数，为 0 时不安装默认规则
+func chunkExpireDays() int {
+	days := config.ConfData.Upload.ChunkExpireDays
+	if days == 0 {
+		return defaultChunkExpireDays
+	}
+	if days < 0 {
+		return 0
+	}
+	return days
+}
+
+// 默认规则，未开启时返回 nil
+func chunkRule() *LifecycleRule {
+	days := chunkExpireDays()
+	if days == 0 {
+		return nil
+	}
+	return &LifecycleRule{
+		ID:             chunkRuleId,
+		Status:         "Enabled",
+		Tags:           map[string]string{chunkTagKey: chunkTagValue},
+		ExpirationDays: days,
+	}
+}
+
+// 写入分片对象时通过 X-Amz-Tagging 添加过期标签，暂存后复制的分片也会保留标签
+func tagChunk(opts *minio.PutObjectOptions) {
+	if chunkRule() == nil {
+		return
+	}
+	if opts.UserMetadata == nil {
+		opts.UserMetadata = make(map[string]string)
+	}
+	opts.UserMetadata[headerTagging] = encodeTagging(map[string]string{chunkTagKey: chunkTagValue})
+}
+
+// 只有一个分片时存储端复制对象会保留分片的过期标签，合并后写入上传时指定的标签或清除标签
+func untagMergedChunk(bucketname, objectname string, shardPaths []SrcInfo, tags map[string]string) error {
+	if len(tags) > 0 || len(shardPaths) != 1 || chunkRule() == nil {
+		return putObjectTags(bucketname, objectname, tags)
+	}
+	if err := store.SetObjectTagging(bucketname, objectname, nil); err != nil {
+		logx.Errorf("untag %s/%s %v", bucketname, objectname, err)
+		store.RemoveObject(bucketname, objectname)
+		return err
+	}
+	return nil
+}
+
+// 查询生命周期规则，未配置时返回空列表
+func getBucketLifecycle(bucketname string) (*BucketLifecycle, error) {
+	data, err := store.GetBucketLifecycle(bucketname)
+	if err != nil {
+		return nil, err
+	}
+	lifecycle := &BucketLifecycle{Rules: []*LifecycleRule{}}
+	if data == "" {
+		return lifecycle, nil
+	}
+	conf := lifecycleConfiguration{}
+	if err := xml.Unmarshal([]byte(data), &conf); err != nil {
+		return nil, err
+	}
+	for _, v := range conf.Rules {
+		lifecycle.Rules = append(lifecycle.Rules, v.rule())
+	}
+	return lifecycle, nil
+}
+
+// 覆盖生命周期规则，默认规则的 ID 为保留 ID，始终使用服务的默认规则
+// 规则为空且未开启默认规则时删除配置
+func setBucketLifecycle(bucketname string, rules []*LifecycleRule) error {
+	if err := validLifecycleRules(rules); err != nil {
+		return err
+	}
+	conf := lifecycleConfiguration{Rules: make([]lifecycleRule, 0, len(rules)+1)}
+	for _, v := range rules {
+		conf.Rules = append(conf.Rules, newLifecycleRule(v))
+	}
+	return saveLifecycle(bucketname, conf)
+}
+
+// 替换默认规则后写入配置
+// 同一配置中不能混用旧版本的 Prefix 和 Filter，旧版本规则的前缀统一移到 Filter 中
+func saveLifecycle(bucketname string, conf lifecycleConfiguration) error {
+	rules := conf.Rules
+	conf.Rules = make([]lifecycleRule, 0, len(rules)+1)
+	for _, v := range rules {
+		if v.ID == chunkRuleId {
+			continue
+		}
+		if v.Prefix != nil {
+			if v.Filter == nil {
+				v.Filter = &lifecycleFilter{Prefix: v.Prefix}
+			}
+			v.Prefix = nil
+		}
+		conf.Rules = append(conf.Rules, v)
+	}
+	if rule := chunkRule(); rule != nil {
+		conf.Rules = append(conf.Rules, newLifecycleRule(rule))
+	}
+	if len(conf.Rules) == 0 {
+		return store.SetBucketLifecycle(bucketname, "")
+	}
+	body, err := xml.Marshal(conf)
+	if err != nil {
+		return err
+	}
+	return store.SetBucketLifecycle(bucketname, string(body))
+}
+
+// 删除用户配置的规则，保留默认规则
+func deleteBucketLifecycle(bucketname string) error {
+	return setBucketLifecycle(bucketname, nil)
+}
+
+// 安装或更新默认规则，已有规则保持不变
+func ensureChunkRule(bucketname string) error {
+	data, err := store.GetBucketLifecycle(bucketname)
+	if err != nil {
+		return err
+	}
+	conf := lifecycleConfiguration{}
+	if data != "" {
+		if err := xml.Unmarshal([]byte(data), &conf); err != nil {
+			return err
+		}
+	}
+	want := chunkRule()
+	var current *LifecycleRule
+	for _, v := range conf.Rules {
+		if v.ID == chunkRuleId {
+			current = v.rule()
+		}
+	}
+	// 已有完全相同的默认规则(或都没有)时不重写配置，重启时不会改动已安装的桶
+	if reflect.DeepEqual(current, want) {
+		return nil
+	}
+	return saveLifecycle(bucketname, conf)
+}
+
+// 启动时给已有的桶安装默认规则，已包含默认规则的桶跳过
+func InitLifecycle() {
+	go func() {
+		buckets, err := store.ListBuckets()
+		if err != nil {
+			logx.Errorf("lifecycle ListBuckets %v", err)
+			return
+		}
+		for _, v := range buckets {
+			if err := ensureChunkRule(v.Name); err != nil {
+				logx.Errorf("lifecycle bucket:%s install chunk rule %v", v.Name, err)
+			}
+		}
+	}()
+}
+
+func validLifecycleRules(rules []*LifecycleRule) error {
+	invalid := errorx.WithMsg(errorx.CodeInternalParamsError, errorx.MsgInvalidLifecycle)
+	if len(rules) > maxLifecycleRules {
+		return invalid
+	}
+	ids := make(map[string]bool, len(rules))
+	for _, v := range rules {
+		if v == nil || v.ID == "" || len(v.ID) > maxLifecycleRuleId || ids[v.ID] {
+			return invalid
+		}
+		ids[v.ID] = true
+		switch strings.ToLower(v.Status) {
+		case "", "enabled":
+			v.Status = "Enabled"
+		case "disabled":
+			v.Status = "Disabled"
+		default:
+			return invalid
+		}
+		if !validTags(v.Tags, maxObjectTags) {
+			return invalid
+		}
+		if v.ExpirationDays < 0 || v.NoncurrentVersionExpirationDays < 0 || v.AbortIncompleteUploadDays < 0 {
+			return invalid
+		}
+		if v.ExpirationDays == 0 && v.ExpirationDate == "" && v.NoncurrentVersionExpirationDays == 0 && v.AbortIncompleteUploadDays == 0 {
+			return invalid
+		}
+		if v.ExpirationDate != "" {
+			if v.ExpirationDays > 0 {
+				return invalid
+			}
+			if _, err := time.Parse(lifecycleDateLayout, v.ExpirationDate); err != nil {
+				return invalid
+			}
+		}
+		if v.AbortIncompleteUploadDays > 0 && len(v.Tags) > 0 {
+			return invalid
+		}
+	}
+	return nil
+}
+
+func newLifecycleRule(rule *LifecycleRule) lifecycleRule {
+	v := lifecycleRule{ID: rule.ID, Status: rule.Status, Filter: &lifecycleFilter{}}
+	switch {
+	case len(rule.Tags) == 0:
+		v.Filter.Prefix = &rule.Prefix
+	case len(rule.Tags) == 1 && rule.Prefix == "":
+		v.Filter.Tag = &newTagging(rule.Tags).TagSet[0]
+	default:
+		v.Filter.And = &lifecycleAnd{Prefix: rule.Prefix, Tags: newTagging(rule.Tags).TagSet}
+	}
+	if rule.ExpirationDays > 0 || rule.ExpirationDate != "" {
+		v.Expiration = &lifecycleExpiration{Days: rule.ExpirationDays}
+		if rule.ExpirationDate != "" {
+			v.Expiration.Date = rule.ExpirationDate + "T00:00:00Z"
+		}
+	}
+	if rule.NoncurrentVersionExpirationDays > 0 {
+		v.NoncurrentVersionExpiration = &noncurrentVersionExpiration{NoncurrentDays: rule.NoncurrentVersionExpirationDays}
+	}
+	if rule.AbortIncompleteUploadDays > 0 {
+		v.AbortIncompleteMultipartUpload = &abortIncompleteMultipartUpload{DaysAfterInitiation: rule.AbortIncompleteUploadDays}
+	}
+	return v
+}
+
+func (v lifecycleRule) rule() *LifecycleRule {
+	rule := &LifecycleRule{ID: v.ID, Status: v.Status}
+	if v.Prefix != nil {
+		rule.Prefix = *v.Prefix
+	}
+	if f := v.Filter; f != nil {
+		var tags []tag
+		switch {
+		case f.And != nil:
+			rule.Prefix = f.And.Prefix
+			tags = f.And.Tags
+		case f.Tag != nil:
+			tags = []tag{*f.Tag}
+		case f.Prefix != nil:
+			rule.Prefix = *f.Prefix
+		}
+		if len(tags) > 0 {
+			rule.Tags = make(map[string]string, len(tags))
+			for _, t := range tags {
+				rule.Tags[t.Key] = t.Value
+			}
+		}
+	}
+	if v.Expiration != nil {
+		rule.ExpirationDays = v.Expiration.Days
+		if v.Expiration.Date != "" {
+			if date, err := time.Parse(time.RFC3339, v.Expiration.Date); err == nil {
+				rule.ExpirationDate = date.UTC().Format(lifecycleDateLayout)
+			}
+		}
+	}
+	if v.NoncurrentVersionExpiration != nil {
+		rule.NoncurrentVersionExpirationDays = v.NoncurrentVersionExpiration.NoncurrentDays
+	}
+	if v.AbortIncompleteMultipartUpload != nil {
+		rule.AbortIncompleteUploadDays = v.AbortIncompleteMultipartUpload.DaysAfterInitiation
+	}
+	return rule
+}
+
+// 从 json 读取规则：{"rules": [...]}
+func parseBucketLifecycle(data []byte) (*BucketLifecycle, error) {
+	lifecycle := &BucketLifecycle{}
+	if err := json.Unmarshal(data, lifecycle); err != nil {
+		return nil, errorx.WithMsg(errorx.CodeInternalParamsError, errorx.MsgInvalidLifecycle)
+	}
+	return lifecycle, nil
+}
+
+// 查询生命周期规则
+func GetBucketLifecycle(w http.ResponseWriter, r *http.Request) {
+	bucketname := r.FormValue("bucket_name")
+	if !checkPermission(w, r, bucketname, ActionList) {
+		return
+	}
+	lifecycle, err := getBucketLifecycle(bucketname)
+	if err != nil {
+		errorx.WriteOk(w, r, err)
+		return
+	}
+	errorx.Ok(w, r, lifecycle)
+}
+
+// 设置生命周期规则，表单字段 rules 为 json 数组
+func SetBucketLifecycle(w http.ResponseWriter, r *http.Request) {
+	bucketname := r.PostFormValue("bucket_name")
+	if !checkPermission(w, r, bucketname, ActionAdmin) {
+		return
+	}
+	rules := []*LifecycleRule{}
+	if err := json.Unmarshal([]byte(r.PostFormValue("rules")), &rules); err != nil {
+		errorx.WriteOk(w, r, errorx.WithMsg(errorx.CodeInternalParamsError, errorx.MsgInvalidLifecycle))
+		return
+	}
+	if err := setBucketLifecycle(bucketname, rules); err != nil {
+		errorx.WriteOk(w, r, err)
+		return
+	}
+	errorx.Ok(w, r, nil)
+}
+
+// 删除生命周期规则，默认规则保留
+func DeleteBucketLifecycle(w http.ResponseWriter, r *http.Request) {
+	bucketname := r.PostFormValue("bucket_name")
+	if !checkPermission(w, r, bucketname, ActionAdmin) {
+		return
+	}
+	if err := deleteBucketLifecycle(bucketname); err != nil {
+		errorx.WriteOk(w, r, err)
+		return
+	}
+	errorx.Ok(w, r, nil)
+}
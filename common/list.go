@@ -0,0 +1,242 @@
+package common
+
+import (
+	"minio_demo/errorx"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go"
+	"github.com/zituocn/logx"
+)
+
+// 单页最大数量，与 S3 ListObjectsV2 一致
+const maxListKeys = 1000
+
+const (
+	SortByName         = "name"
+	SortBySize         = "size"
+	SortByLastModified = "last_modified"
+)
+
+// 对象列表查询条件
+type ListOptions struct {
+	Prefix            string
+	Delimiter         string
+	MaxKeys           int
+	ContinuationToken string
+	// 分页顺序始终按 key 字典序，过滤掉的对象由后续数据补足一页，排序只作用于当前页
+	SortBy         string
+	Desc           bool
+	MinSize        int64
+	MaxSize        int64
+	ModifiedAfter  time.Time
+	ModifiedBefore time.Time
+}
+
+type ObjectList struct {
+	Objects []*FileSaveInfo `json:"objects"`
+	// delimiter 非空时的虚拟目录
+	Prefixes              []string `json:"prefixes"`
+	IsTruncated           bool     `json:"isTruncated"`
+	NextContinuationToken string   `json:"nextContinuationToken,omitempty"`
+}
+
+// 解析查询条件：prefix、delimiter、max_keys、continuation_token、sort_by、order、
+// min_size、max_size、modified_after、modified_before
+func parseListOptions(r *http.Request) (*ListOptions, error) {
+	invalid := errorx.WithMsg(errorx.CodeInternalParamsError, errorx.MsgInvalidListOptions)
+	opts := &ListOptions{
+		Prefix:            r.FormValue("prefix"),
+		Delimiter:         r.FormValue("delimiter"),
+		MaxKeys:           maxListKeys,
+		ContinuationToken: r.FormValue("continuation_token"),
+		SortBy:            SortByName,
+	}
+	if v := r.FormValue("max_keys"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxListKeys {
+			return nil, invalid
+		}
+		opts.MaxKeys = n
+	}
+	if v := r.FormValue("sort_by"); v != "" {
+		switch v {
+		case SortByName, SortBySize, SortByLastModified:
+			opts.SortBy = v
+		default:
+			return nil, invalid
+		}
+	}
+	switch strings.ToLower(r.FormValue("order")) {
+	case "", "asc":
+	case "desc":
+		opts.Desc = true
+	default:
+		return nil, invalid
+	}
+	// 其他排序只作用于单页，翻页后顺序不连续
+	if opts.ContinuationToken != "" && (opts.SortBy != SortByName || opts.Desc) {
+		return nil, invalid
+	}
+
+	var err error
+	if opts.MinSize, err = parseSize(r.FormValue("min_size")); err != nil {
+		return nil, invalid
+	}
+	if opts.MaxSize, err = parseSize(r.FormValue("max_size")); err != nil {
+		return nil, invalid
+	}
+	if opts.ModifiedAfter, err = parseListTime(r.FormValue("modified_after")); err != nil {
+		return nil, invalid
+	}
+	if opts.ModifiedBefore, err = parseListTime(r.FormValue("modified_before")); err != nil {
+		return nil, invalid
+	}
+	return opts, nil
+}
+
+func parseSize(v string) (int64, error) {
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err == nil && n < 0 {
+		err = strconv.ErrRange
+	}
+	return n, err
+}
+
+// 支持与返回值一致的 2006-01-02 15:04:05 格式和 RFC3339
+func parseListTime(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02 15:04:05", v, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+func (opts *ListOptions) match(size int64, lastModified time.Time) bool {
+	if size < opts.MinSize || (opts.MaxSize > 0 && size > opts.MaxSize) {
+		return false
+	}
+	if !opts.ModifiedAfter.IsZero() && lastModified.Before(opts.ModifiedAfter) {
+		return false
+	}
+	if !opts.ModifiedBefore.IsZero() && lastModified.After(opts.ModifiedBefore) {
+		return false
+	}
+	return true
+}
+
+// 分页查询对象，过滤掉的对象不占用数量，继续读取直到满一页或列表结束
+// 排序只作用于当前页，按 key 升序以外的排序不能与 continuation_token 一起使用
+func listObjectPage(bucketname string, opts *ListOptions) (*ObjectList, error) {
+	list := &ObjectList{Prefixes: make([]string, 0)}
+	contents := make([]minio.ObjectInfo, 0)
+	token := opts.ContinuationToken
+	for {
+		// 只读取当前页剩余的数量，下一页的 token 才能从最后一个返回的 key 继续
+		need := opts.MaxKeys - len(contents) - len(list.Prefixes)
+		result, err := store.ListObjectsV2(bucketname, opts.Prefix, token, opts.Delimiter, need)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range result.CommonPrefixes {
+			list.Prefixes = append(list.Prefixes, v.Prefix)
+		}
+		for _, v := range result.Contents {
+			if opts.match(v.Size, v.LastModified) {
+				contents = append(contents, v)
+			}
+		}
+		list.IsTruncated = result.IsTruncated
+		list.NextContinuationToken = result.NextContinuationToken
+		if !result.IsTruncated || result.NextContinuationToken == "" || len(contents)+len(list.Prefixes) >= opts.MaxKeys {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+
+	var modified map[*FileSaveInfo]time.Time
+	list.Objects, modified = objectInfos(bucketname, contents)
+	sortObjects(list.Objects, modified, opts)
+	if opts.Desc {
+		sort.SliceStable(list.Prefixes, func(i, j int) bool { return list.Prefixes[i] > list.Prefixes[j] })
+	}
+	return list, nil
+}
+
+// 递归查询前缀下的全部对象，用于未使用分页参数的旧接口，排序作用于全部结果
+func listAllObjects(bucketname string, opts *ListOptions) ([]*FileSaveInfo, error) {
+	doneCh := make(chan struct{})
+	defer close(doneCh)
+
+	contents := make([]minio.ObjectInfo, 0)
+	for message := range store.ListObjects(bucketname, opts.Prefix, true, doneCh) {
+		if message.Err != nil {
+			logx.Error("ListObjects error:", message.Err.Error())
+			return nil, message.Err
+		}
+		if opts.match(message.Size, message.LastModified) {
+			contents = append(contents, message)
+		}
+	}
+	objects, modified := objectInfos(bucketname, contents)
+	sortObjects(objects, modified, opts)
+	return objects, nil
+}
+
+// 列表接口不返回元数据，使用上传时保存的文件记录补全，同时返回对象的修改时间用于排序
+func objectInfos(bucketname string, contents []minio.ObjectInfo) ([]*FileSaveInfo, map[*FileSaveInfo]time.Time) {
+	names := make([]string, 0, len(contents))
+	for _, v := range contents {
+		names = append(names, v.Key)
+	}
+	records, err := metadata.GetByNames(bucketname, names)
+	if err != nil {
+		logx.Error("metadata GetByNames error:", err.Error())
+	}
+	objects := make([]*FileSaveInfo, 0, len(contents))
+	modified := make(map[*FileSaveInfo]time.Time, len(contents))
+	for _, v := range contents {
+		info := &FileSaveInfo{
+			BucketName:   bucketname,
+			ObjectName:   v.Key,
+			LastModified: v.LastModified.Format("2006-01-02 15:04:05"),
+			Size:         v.Size,
+			Md5:          removeBackslashAndQuotes(v.ETag),
+			StorageClass: v.StorageClass,
+		}
+		// 对象已被覆盖时不使用文件记录
+		if record, ok := records[v.Key]; ok &&
+			record.Size == info.Size && record.LastModified == info.LastModified {
+			info.ContentType = record.ContentType
+			info.Metadata = record.Metadata
+			info.Tags = record.Tags
+		}
+		modified[info] = v.LastModified
+		objects = append(objects, info)
+	}
+	return objects, modified
+}
+
+func sortObjects(objects []*FileSaveInfo, modified map[*FileSaveInfo]time.Time, opts *ListOptions) {
+	sort.SliceStable(objects, func(i, j int) bool {
+		a, b := objects[i], objects[j]
+		if opts.Desc {
+			a, b = b, a
+		}
+		switch opts.SortBy {
+		case SortBySize:
+			return a.Size < b.Size
+		case SortByLastModified:
+			return modified[a].Before(modified[b])
+		}
+		return a.ObjectName < b.ObjectName
+	})
+}
@@ -0,0 +1,67 @@
+package common
+
+import (
+	"errors"
+	"minio_demo/config"
+)
+
+var ErrMetadataNotFound = errors.New("metadata not found")
+
+// 文件记录存储，md5 索引用于秒传，桶名+文件名索引用于处理同名文件
+type MetadataStore interface {
+	// 根据md5值查询文件记录
+	GetByMd5(md5 string) (*FileSaveInfo, error)
+	// 根据桶名、文件名查询文件记录
+	GetByName(bucketname, filename string) (*FileSaveInfo, error)
+	// 批量查询同一个桶内的文件记录，key 为文件名，没有记录的文件不返回
+	GetByNames(bucketname string, filenames []string) (map[string]*FileSaveInfo, error)
+	// 保存文件记录，md5 为空时只写入桶名+文件名索引
+	// 覆盖同名文件记录时删除指向旧文件的md5索引
+	Save(md5 string, info *FileSaveInfo) error
+	// 删除md5索引，只在索引仍指向 info 的同一版本时删除
+	DeleteMd5(md5 string, info *FileSaveInfo) error
+	// 删除文件记录，同时删除指向该文件的md5索引
+	Delete(bucketname, filename string) error
+	// 删除指定版本的文件记录，只删除指向该版本的md5索引和桶名+文件名索引
+	DeleteVersion(info *FileSaveInfo) error
+	// 删除桶内的全部文件记录和指向这些文件的md5索引
+	DeleteBucket(bucketname string) error
+	// 桶存储配额(字节)，0 表示不限制，删除桶记录时一并删除
+	GetBucketQuota(bucketname string) (int64, error)
+	SetBucketQuota(bucketname string, quota int64) error
+	// 设置了配额的桶的已用容量(字节)，写入和删除对象时累加，删除桶记录时一并删除
+	GetBucketUsage(bucketname string) (int64, error)
+	// 原子累加，返回累加后的已用容量
+	AddBucketUsage(bucketname string, delta int64) (int64, error)
+	SetBucketUsage(bucketname string, usage int64) error
+	// 列出桶内的文件记录
+	List(bucketname string) ([]*FileSaveInfo, error)
+	// 列出有文件记录、配额或已用容量的桶
+	ListBuckets() ([]string, error)
+	// 列出全部md5索引，key 为md5值
+	ListMd5() (map[string]*FileSaveInfo, error)
+	// 动态维护的桶权限策略，与配置文件中的策略合并生效
+	ListPolicies() ([]config.Policy, error)
+}
+
+var metadata MetadataStore
+
+// 注入文件记录存储实现
+func SetMetadataStore(m MetadataStore) {
+	metadata = m
+}
+
+// 获取当前文件记录存储实现
+func GetMetadataStore() MetadataStore {
+	return metadata
+}
+
+// md5索引是否指向该文件
+func sameObject(a, b *FileSaveInfo) bool {
+	return a.BucketName == b.BucketName && a.ObjectName == b.ObjectName
+}
+
+// 记录是否为同一文件的同一版本
+func sameVersion(a, b *FileSaveInfo) bool {
+	return sameObject(a, b) && a.VersionId == b.VersionId
+}
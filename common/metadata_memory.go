@@ -0,0 +1,210 @@
+package common
+
+import (
+	"minio_demo/config"
+	"sort"
+	"sync"
+)
+
+// 进程内存实现，服务重启后记录丢失
+type memoryMetadataStore struct {
+	mu      sync.RWMutex
+	md5s    map[string]FileSaveInfo
+	buckets map[string]map[string]FileSaveInfo
+	quotas  map[string]int64
+	usages  map[string]int64
+}
+
+func NewMemoryMetadataStore() MetadataStore {
+	return &memoryMetadataStore{
+		md5s:    make(map[string]FileSaveInfo),
+		buckets: make(map[string]map[string]FileSaveInfo),
+		quotas:  make(map[string]int64),
+		usages:  make(map[string]int64),
+	}
+}
+
+func (s *memoryMetadataStore) GetByMd5(md5 string) (*FileSaveInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	info, ok := s.md5s[md5]
+	if !ok {
+		return nil, ErrMetadataNotFound
+	}
+	return &info, nil
+}
+
+func (s *memoryMetadataStore) GetByName(bucketname, filename string) (*FileSaveInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	info, ok := s.buckets[bucketname][filename]
+	if !ok {
+		return nil, ErrMetadataNotFound
+	}
+	return &info, nil
+}
+
+func (s *memoryMetadataStore) GetByNames(bucketname string, filenames []string) (map[string]*FileSaveInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make(map[string]*FileSaveInfo, len(filenames))
+	for _, filename := range filenames {
+		if info, ok := s.buckets[bucketname][filename]; ok {
+			list[filename] = &info
+		}
+	}
+	return list, nil
+}
+
+func (s *memoryMetadataStore) Save(md5 string, info *FileSaveInfo) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// 覆盖同名文件记录时删除指向旧文件的md5索引
+	if old, ok := s.buckets[info.BucketName][info.ObjectName]; ok && old.Md5 != "" && old.Md5 != md5 {
+		if indexed, ok := s.md5s[old.Md5]; ok && sameObject(&indexed, &old) {
+			delete(s.md5s, old.Md5)
+		}
+	}
+	if md5 != "" {
+		s.md5s[md5] = *info
+	}
+	if _, ok := s.buckets[info.BucketName]; !ok {
+		s.buckets[info.BucketName] = make(map[string]FileSaveInfo)
+	}
+	s.buckets[info.BucketName][info.ObjectName] = *info
+	return nil
+}
+
+func (s *memoryMetadataStore) Delete(bucketname, filename string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info, ok := s.buckets[bucketname][filename]
+	if !ok {
+		return nil
+	}
+	if indexed, ok := s.md5s[info.Md5]; ok && sameObject(&indexed, &info) {
+		delete(s.md5s, info.Md5)
+	}
+	delete(s.buckets[bucketname], filename)
+	return nil
+}
+
+func (s *memoryMetadataStore) DeleteMd5(md5 string, info *FileSaveInfo) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if indexed, ok := s.md5s[md5]; ok && sameVersion(&indexed, info) {
+		delete(s.md5s, md5)
+	}
+	return nil
+}
+
+func (s *memoryMetadataStore) DeleteVersion(info *FileSaveInfo) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if indexed, ok := s.md5s[info.Md5]; ok && sameVersion(&indexed, info) {
+		delete(s.md5s, info.Md5)
+	}
+	if record, ok := s.buckets[info.BucketName][info.ObjectName]; ok && sameVersion(&record, info) {
+		delete(s.buckets[info.BucketName], info.ObjectName)
+	}
+	return nil
+}
+
+func (s *memoryMetadataStore) DeleteBucket(bucketname string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, info := range s.buckets[bucketname] {
+		if indexed, ok := s.md5s[info.Md5]; ok && sameObject(&indexed, &info) {
+			delete(s.md5s, info.Md5)
+		}
+	}
+	delete(s.buckets, bucketname)
+	delete(s.quotas, bucketname)
+	delete(s.usages, bucketname)
+	return nil
+}
+
+func (s *memoryMetadataStore) GetBucketQuota(bucketname string) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.quotas[bucketname], nil
+}
+
+func (s *memoryMetadataStore) SetBucketQuota(bucketname string, quota int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if quota <= 0 {
+		delete(s.quotas, bucketname)
+	} else {
+		s.quotas[bucketname] = quota
+	}
+	return nil
+}
+
+func (s *memoryMetadataStore) GetBucketUsage(bucketname string) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.usages[bucketname], nil
+}
+
+func (s *memoryMetadataStore) AddBucketUsage(bucketname string, delta int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.usages[bucketname] += delta
+	return s.usages[bucketname], nil
+}
+
+func (s *memoryMetadataStore) SetBucketUsage(bucketname string, usage int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.usages[bucketname] = usage
+	return nil
+}
+
+func (s *memoryMetadataStore) List(bucketname string) ([]*FileSaveInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make([]*FileSaveInfo, 0, len(s.buckets[bucketname]))
+	for _, v := range s.buckets[bucketname] {
+		info := v
+		list = append(list, &info)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ObjectName < list[j].ObjectName })
+	return list, nil
+}
+
+func (s *memoryMetadataStore) ListBuckets() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	set := make(map[string]bool)
+	for _, m := range []map[string]int64{s.quotas, s.usages} {
+		for bucketname := range m {
+			set[bucketname] = true
+		}
+	}
+	for bucketname := range s.buckets {
+		set[bucketname] = true
+	}
+	list := make([]string, 0, len(set))
+	for bucketname := range set {
+		list = append(list, bucketname)
+	}
+	sort.Strings(list)
+	return list, nil
+}
+
+func (s *memoryMetadataStore) ListMd5() (map[string]*FileSaveInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make(map[string]*FileSaveInfo, len(s.md5s))
+	for md5, info := range s.md5s {
+		info := info
+		list[md5] = &info
+	}
+	return list, nil
+}
+
+// 内存实现只使用配置文件中的策略
+func (s *memoryMetadataStore) ListPolicies() ([]config.Policy, error) {
+	return nil, nil
+}
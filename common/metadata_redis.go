@@ -0,0 +1,315 @@
+package common
+
+import (
+	"encoding/json"
+	"minio_demo/config"
+	"strings"
+
+	"github.com/go-redis/redis"
+)
+
+// Redis 实现
+// key 规划：
+//
+//	<md5>                string  文件记录，用于秒传
+//	<bucketname>         hash    field 为文件名，value 为文件记录
+//	minio_demo:policies  string  桶权限策略(json 数组)，桶名不能包含冒号，不会冲突
+//	minio_demo:quotas    hash    field 为桶名，value 为存储配额(字节)
+//	minio_demo:usages    hash    field 为桶名，value 为已用容量(字节)
+type redisMetadataStore struct {
+	db *redis.Client
+}
+
+func NewRedisMetadataStore(db *redis.Client) MetadataStore {
+	return &redisMetadataStore{db: db}
+}
+
+func (s *redisMetadataStore) md5Key(md5 string) string {
+	return md5
+}
+
+func (s *redisMetadataStore) bucketKey(bucketname string) string {
+	return bucketname
+}
+
+func (s *redisMetadataStore) policiesKey() string {
+	return "minio_demo:policies"
+}
+
+func (s *redisMetadataStore) quotasKey() string {
+	return "minio_demo:quotas"
+}
+
+func (s *redisMetadataStore) usagesKey() string {
+	return "minio_demo:usages"
+}
+
+func (s *redisMetadataStore) GetByMd5(md5 string) (*FileSaveInfo, error) {
+	info := &FileSaveInfo{}
+	err := s.db.Get(s.md5Key(md5)).Scan(info)
+	if err == redis.Nil {
+		return nil, ErrMetadataNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func (s *redisMetadataStore) GetByName(bucketname, filename string) (*FileSaveInfo, error) {
+	info := &FileSaveInfo{}
+	err := s.db.HGet(s.bucketKey(bucketname), filename).Scan(info)
+	if err == redis.Nil {
+		return nil, ErrMetadataNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func (s *redisMetadataStore) GetByNames(bucketname string, filenames []string) (map[string]*FileSaveInfo, error) {
+	list := make(map[string]*FileSaveInfo, len(filenames))
+	if len(filenames) == 0 {
+		return list, nil
+	}
+	values, err := s.db.HMGet(s.bucketKey(bucketname), filenames...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i, v := range values {
+		data, ok := v.(string)
+		if !ok {
+			continue
+		}
+		info := &FileSaveInfo{}
+		if err := info.UnmarshalBinary([]byte(data)); err != nil {
+			return nil, err
+		}
+		list[filenames[i]] = info
+	}
+	return list, nil
+}
+
+func (s *redisMetadataStore) Save(md5 string, info *FileSaveInfo) error {
+	old, err := s.GetByName(info.BucketName, info.ObjectName)
+	if err != nil && err != ErrMetadataNotFound {
+		return err
+	}
+	if old != nil && old.Md5 != "" && old.Md5 != md5 {
+		if indexed, err := s.GetByMd5(old.Md5); err == nil && sameObject(indexed, old) {
+			if err := s.db.Del(s.md5Key(old.Md5)).Err(); err != nil {
+				return err
+			}
+		}
+	}
+	if md5 != "" {
+		if err := s.db.Set(s.md5Key(md5), info, 0).Err(); err != nil {
+			return err
+		}
+	}
+	return s.db.HSet(s.bucketKey(info.BucketName), info.ObjectName, info).Err()
+}
+
+func (s *redisMetadataStore) Delete(bucketname, filename string) error {
+	info, err := s.GetByName(bucketname, filename)
+	if err == ErrMetadataNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Md5 != "" {
+		if indexed, err := s.GetByMd5(info.Md5); err == nil && sameObject(indexed, info) {
+			if err := s.db.Del(s.md5Key(info.Md5)).Err(); err != nil {
+				return err
+			}
+		}
+	}
+	return s.db.HDel(s.bucketKey(bucketname), filename).Err()
+}
+
+func (s *redisMetadataStore) DeleteMd5(md5 string, info *FileSaveInfo) error {
+	indexed, err := s.GetByMd5(md5)
+	if err == ErrMetadataNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !sameVersion(indexed, info) {
+		return nil
+	}
+	return s.db.Del(s.md5Key(md5)).Err()
+}
+
+func (s *redisMetadataStore) DeleteVersion(info *FileSaveInfo) error {
+	if info.Md5 != "" {
+		if indexed, err := s.GetByMd5(info.Md5); err == nil && sameVersion(indexed, info) {
+			if err := s.db.Del(s.md5Key(info.Md5)).Err(); err != nil {
+				return err
+			}
+		}
+	}
+	record, err := s.GetByName(info.BucketName, info.ObjectName)
+	if err == ErrMetadataNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !sameVersion(record, info) {
+		return nil
+	}
+	return s.db.HDel(s.bucketKey(info.BucketName), info.ObjectName).Err()
+}
+
+func (s *redisMetadataStore) DeleteBucket(bucketname string) error {
+	list, err := s.List(bucketname)
+	if err != nil {
+		return err
+	}
+	for _, info := range list {
+		if info.Md5 == "" {
+			continue
+		}
+		if indexed, err := s.GetByMd5(info.Md5); err == nil && sameObject(indexed, info) {
+			if err := s.db.Del(s.md5Key(info.Md5)).Err(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := s.db.HDel(s.quotasKey(), bucketname).Err(); err != nil {
+		return err
+	}
+	if err := s.db.HDel(s.usagesKey(), bucketname).Err(); err != nil {
+		return err
+	}
+	return s.db.Del(s.bucketKey(bucketname)).Err()
+}
+
+func (s *redisMetadataStore) GetBucketQuota(bucketname string) (int64, error) {
+	quota, err := s.db.HGet(s.quotasKey(), bucketname).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return quota, err
+}
+
+func (s *redisMetadataStore) SetBucketQuota(bucketname string, quota int64) error {
+	if quota <= 0 {
+		return s.db.HDel(s.quotasKey(), bucketname).Err()
+	}
+	return s.db.HSet(s.quotasKey(), bucketname, quota).Err()
+}
+
+func (s *redisMetadataStore) GetBucketUsage(bucketname string) (int64, error) {
+	usage, err := s.db.HGet(s.usagesKey(), bucketname).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return usage, err
+}
+
+func (s *redisMetadataStore) AddBucketUsage(bucketname string, delta int64) (int64, error) {
+	return s.db.HIncrBy(s.usagesKey(), bucketname, delta).Result()
+}
+
+func (s *redisMetadataStore) SetBucketUsage(bucketname string, usage int64) error {
+	return s.db.HSet(s.usagesKey(), bucketname, usage).Err()
+}
+
+func (s *redisMetadataStore) List(bucketname string) ([]*FileSaveInfo, error) {
+	values, err := s.db.HGetAll(s.bucketKey(bucketname)).Result()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*FileSaveInfo, 0, len(values))
+	for _, v := range values {
+		info := &FileSaveInfo{}
+		if err := info.UnmarshalBinary([]byte(v)); err != nil {
+			return nil, err
+		}
+		list = append(list, info)
+	}
+	return list, nil
+}
+
+func (s *redisMetadataStore) ListBuckets() ([]string, error) {
+	set := make(map[string]bool)
+	for _, key := range []string{s.quotasKey(), s.usagesKey()} {
+		names, err := s.db.HKeys(key).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range names {
+			set[v] = true
+		}
+	}
+	// 文件记录的 hash 没有统一前缀，按桶命名规则遍历，跳过其他类型的 key
+	iter := s.db.Scan(0, "*", 1000).Iterator()
+	for iter.Next() {
+		key := iter.Val()
+		if set[key] || validateBucketName(key) != nil {
+			continue
+		}
+		typ, err := s.db.Type(key).Result()
+		if err != nil {
+			return nil, err
+		}
+		if typ == "hash" {
+			set[key] = true
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	list := make([]string, 0, len(set))
+	for bucketname := range set {
+		list = append(list, bucketname)
+	}
+	return list, nil
+}
+
+// md5 索引没有统一前缀，按 32 位十六进制 key 遍历
+var redisMd5Pattern = strings.Repeat("[0-9a-fA-F]", 32)
+
+func (s *redisMetadataStore) ListMd5() (map[string]*FileSaveInfo, error) {
+	list := make(map[string]*FileSaveInfo)
+	iter := s.db.Scan(0, redisMd5Pattern, 1000).Iterator()
+	for iter.Next() {
+		md5 := iter.Val()
+		// 桶名也可能是32位十六进制字符串，跳过桶的 hash
+		typ, err := s.db.Type(md5).Result()
+		if err != nil {
+			return nil, err
+		}
+		if typ != "string" {
+			continue
+		}
+		info, err := s.GetByMd5(md5)
+		if err == ErrMetadataNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		list[md5] = info
+	}
+	return list, iter.Err()
+}
+
+func (s *redisMetadataStore) ListPolicies() ([]config.Policy, error) {
+	data, err := s.db.Get(s.policiesKey()).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	policies := make([]config.Policy, 0)
+	if err := json.Unmarshal(data, &policies); err != nil {
+		return nil, err
+	}
+	return policies, nil
+}
@@ -3,27 +3,16 @@ package common
 import (
 	"fmt"
 	"io"
-	"log"
 	"minio_demo/config"
+	"minio_demo/errorx"
 	"net/http"
 	"os"
 	"strconv"
-	"strings"
-	"sync"
 
 	"github.com/minio/minio-go"
-	"github.com/zeromicro/go-zero/rest/httpx"
 	"github.com/zituocn/logx"
 )
 
-var (
-	client        *minio.Client
-	is_exists_key map[string]map[string]bool
-	muxing        map[string]bool
-
-	mu sync.RWMutex
-)
-
 type SrcInfo struct {
 	Etag string
 	Name string
@@ -37,6 +26,7 @@ type BucketInfo struct {
 type ObjectInfo struct {
 	ETag string `json:"etag"`
 
+	BucketName   string `json:"bucket_name"`
 	Key          string `json:"name"`         // Name of the object
 	LastModified string `json:"lastModified"` // Date and time the object was last modified.
 	Size         int64  `json:"size"`         // Size in bytes of the object.
@@ -45,6 +35,9 @@ type ObjectInfo struct {
 	// Collection of additional metadata on the object.
 	// eg: x-amz-meta-*, content-encoding etc.
 	Metadata http.Header `json:"metadata" xml:"-"`
+	// 自定义元数据，key 不含 x-amz-meta- 前缀
+	UserMetadata map[string]string `json:"userMetadata"`
+	Tags         map[string]string `json:"tags"`
 
 	// Owner name.
 	Owner struct {
@@ -54,12 +47,27 @@ type ObjectInfo struct {
 
 	// The class of storage used to store the object.
 	StorageClass string `json:"storageClass"`
+	// 桶未开启版本控制时为空
+	VersionID string `json:"versionId"`
+	// 对象锁定状态，桶未开启对象锁定时为空
+	Retention *ObjectRetention `json:"retention"`
+	LegalHold string           `json:"legalHold"`
+}
+
+type ObjectRetention struct {
+	// GOVERNANCE 或 COMPLIANCE
+	Mode            string `json:"mode"`
+	RetainUntilDate string `json:"retainUntilDate"`
 }
 
 func InitMinio() {
-	is_exists_key = make(map[string]map[string]bool, 0)
-	muxing = make(map[string]bool, 0)
-	client = InitMinioClient()
+	switch config.ConfData.Storage.Object {
+	case "memory":
+		logx.Info("Memory object store start")
+		SetObjectStore(NewMemoryStore())
+	default:
+		SetObjectStore(NewMinioStore(InitMinioClient(), config.ConfData.Minio))
+	}
 }
 
 func InitMinioClient() *minio.Client {
@@ -67,7 +75,7 @@ func InitMinioClient() *minio.Client {
 	endpoint := config.ConfData.Minio.Address + ":" + strconv.Itoa(config.ConfData.Minio.Port)
 	accessKeyID := config.ConfData.Minio.AccessKeyID
 	secretAccessKey := config.ConfData.Minio.SecretAccessKey
-	minioClient, err := minio.New(endpoint, accessKeyID, secretAccessKey, false)
+	minioClient, err := minio.New(endpoint, accessKeyID, secretAccessKey, config.ConfData.Minio.UseSSL)
 	if err != nil {
 		logx.Fatalf("初始化MinioClient错误：%s", err.Error())
 	} else {
@@ -78,6 +86,9 @@ func InitMinioClient() *minio.Client {
 
 // 创建桶
 func Test(w http.ResponseWriter, r *http.Request) {
+	if !checkPermission(w, r, "", ActionAdmin) {
+		return
+	}
 	x, err := redisdb.Incr("minio").Result()
 	fmt.Println("x==", x)
 	fmt.Println("err==", err)
@@ -103,294 +114,325 @@ func Test(w http.ResponseWriter, r *http.Request) {
 // 创建桶
 func CreateBucket(w http.ResponseWriter, r *http.Request) {
 	bucketname := r.PostFormValue("bucket_name")
+	if !checkPermission(w, r, bucketname, ActionAdmin) {
+		return
+	}
 
-	err := client.MakeBucket(bucketname, "")
+	opts, err := parseBucketOptions(r)
 	if err != nil {
-		httpx.OkJson(w, ResponseData{
-			Code: CodeInternalParamsError,
-			Msg:  "创建桶失败",
-		})
+		errorx.WriteOk(w, r, err)
 		return
 	}
-	httpx.OkJson(w, ResponseData{
-		Code: CodeSuccess,
-		Msg:  "创建桶成功",
-	})
+	info, err := createBucket(bucketname, opts)
+	if err != nil {
+		errorx.WriteOk(w, r, err)
+		return
+	}
+	if !info.Created {
+		errorx.OkMsg(w, r, errorx.MsgBucketExists, info)
+		return
+	}
+	errorx.OkMsg(w, r, errorx.MsgBucketCreated, info)
 }
 
 // 查询对象
 func GetObjectInfo(w http.ResponseWriter, r *http.Request) {
 	bucketname := r.PostFormValue("bucket_name")
 	objectname := r.PostFormValue("object_name")
+	if !checkPermission(w, r, bucketname, ActionRead) {
+		return
+	}
 
-	info, _ := GetStatObject(bucketname, objectname)
-	httpx.OkJson(w, info)
+	info, err := statObjectInfo(bucketname, objectname, r.PostFormValue("version_id"))
+	if err != nil {
+		errorx.WriteOk(w, r, err)
+		return
+	}
+	errorx.Ok(w, r, info)
 }
 
 // 展示桶列表
 func GetBucketList(w http.ResponseWriter, r *http.Request) {
-	lists, err := client.ListBuckets()
+	bucket_list, err := listBuckets(r)
+	if err != nil {
+		errorx.WriteOk(w, r, err)
+		return
+	}
 
-	bucket_list := make([]BucketInfo, 0, len(lists))
+	errorx.Ok(w, r, bucket_list)
+}
+
+// 查询调用方有权限的桶
+func listBuckets(r *http.Request) ([]BucketInfo, error) {
+	lists, err := store.ListBuckets()
+	if err != nil {
+		return nil, err
+	}
 
+	bucket_list := make([]BucketInfo, 0, len(lists))
 	for _, v := range lists {
+		// 只展示有权限的桶
+		if !authorize(r, v.Name, ActionList) {
+			continue
+		}
 		info := BucketInfo{
 			Name:       v.Name,
 			CreateTime: v.CreationDate.Format("2006-01-02 15:04:05"),
 		}
 		bucket_list = append(bucket_list, info)
 	}
-	if err != nil {
-		httpx.OkJson(w, ResponseData{
-			Code: CodeInternalParamsError,
-			Msg:  err.Error(),
-		})
-		return
-	}
-
-	httpx.OkJson(w, ResponseData{
-		Code: CodeSuccess,
-		Msg:  "success",
-		Data: bucket_list,
-	})
+	return bucket_list, nil
 }
 
-// 移除桶
+// 移除桶，force=true 时先清空桶，需要 confirm 参数与桶名一致
 func RemoveBucket(w http.ResponseWriter, r *http.Request) {
 	bucketname := r.PostFormValue("bucket_name")
-	isExist, err := IsBuckets(bucketname)
-
-	if err != nil {
-		httpx.OkJson(w, ResponseData{
-			Code: CodeInternalParamsError,
-			Msg:  "Invalid params",
-		})
+	if !checkPermission(w, r, bucketname, ActionAdmin) {
 		return
 	}
-
-	if !isExist {
-		httpx.OkJson(w, ResponseData{
-			Code: CodeInternalParamsError,
-			Msg:  "Invalid params",
-		})
-		return
-	}
-
-	err = client.RemoveBucket(bucketname)
+	force, _ := strconv.ParseBool(r.PostFormValue("force"))
+	result, err := removeBucket(bucketname, force, r.PostFormValue("confirm"))
 	if err != nil {
-		httpx.OkJson(w, ResponseData{
-			Code: CodeInternalServerError,
-			Msg:  err.Error(),
-		})
+		errorx.WriteOk(w, r, err)
 		return
 	}
 
-	httpx.OkJson(w, ResponseData{
-		Code: CodeSuccess,
-		Msg:  fmt.Sprintf("删除%s桶成功", bucketname),
-	})
+	errorx.OkMsg(w, r, errorx.MsgBucketRemoved, result, bucketname)
 }
 
-// 展示对象
+// 展示对象，支持分页、目录和排序过滤，查询条件见 parseListOptions
+// 未传 max_keys、continuation_token、delimiter 时返回全部对象的数组，否则返回分页结果
 func ListObjects(w http.ResponseWriter, r *http.Request) {
-	bucketname := r.PostFormValue("bucket_name")
-	objectname := r.PostFormValue("object_name")
-	isExist, err := IsBuckets(bucketname)
-
-	if err != nil {
-		logx.Error("IsBuckets error:", err.Error())
-		httpx.OkJson(w, ResponseData{
-			Code: CodeInternalParamsError,
-			Msg:  err.Error(),
-			Data: nil,
-		})
+	bucketname := r.FormValue("bucket_name")
+	if !checkPermission(w, r, bucketname, ActionList) {
+		return
 	}
-
-	if !isExist {
-		logx.Error("bucket not found")
-		httpx.OkJson(w, ResponseData{
-			Code: CodeInternalParamsError,
-			Msg:  "bucket not found",
-			Data: nil,
-		})
+	opts, err := parseListOptions(r)
+	if err != nil {
+		errorx.WriteOk(w, r, err)
 		return
 	}
-
-	doneCh := make(chan struct{})
-	defer close(doneCh)
-
-	objectInfos := make([]*FileSaveInfo, 0)
-
-	for message := range client.ListObjects(bucketname, objectname, true, doneCh) {
-		objectInfo := &FileSaveInfo{
-			BucketName:   bucketname,
-			ObjectName:   message.Key,
-			LastModified: message.LastModified.Format("2006-01-02 15:04:05"),
-			Size:         message.Size,
-			Md5:          removeBackslashAndQuotes(message.ETag),
+	// 兼容旧参数，object_name 作为前缀
+	if opts.Prefix == "" {
+		opts.Prefix = r.FormValue("object_name")
+	}
+	// 未使用分页参数时保持旧接口的行为，返回前缀下的全部对象
+	if r.FormValue("max_keys") == "" && opts.ContinuationToken == "" && opts.Delimiter == "" {
+		objects, err := listAllObjects(bucketname, opts)
+		if err != nil {
+			errorx.WriteOk(w, r, err)
+			return
 		}
-		objectInfos = append(objectInfos, objectInfo)
+		errorx.Ok(w, r, objects)
+		return
 	}
 
-	httpx.OkJson(w, ResponseData{
-		Code: CodeSuccess,
-		Msg:  "success",
-		Data: objectInfos,
-	})
+	list, err := listObjectPage(bucketname, opts)
+	if err != nil {
+		errorx.WriteOk(w, r, err)
+		return
+	}
+	errorx.Ok(w, r, list)
 }
 
 // 获取对象信息
 func GetObject(w http.ResponseWriter, r *http.Request) {
 	bucketname := r.PostFormValue("bucket_name")
 	objectname := r.PostFormValue("object_name")
-	object, err := client.GetObject(bucketname, objectname, minio.GetObjectOptions{})
+	if !checkPermission(w, r, bucketname, ActionRead) {
+		return
+	}
+	object, err := store.GetObject(bucketname, objectname, minio.GetObjectOptions{})
 	if err != nil {
-		httpx.OkJson(w, ResponseData{
-			Code: CodeInternalServerError,
-			Msg:  err.Error(),
-		})
+		errorx.WriteOk(w, r, err)
 		return
 	}
-	defer func(object *minio.Object) {
+	defer func(object StoreObject) {
 		err := object.Close()
 		if err != nil {
-			httpx.Error(w, err)
-			return
+			logx.Error("Close error:", err.Error())
 		}
 	}(object)
 
 	localFile, err := os.Create("images/" + objectname)
 	if err != nil {
-		httpx.OkJson(w, ResponseData{
-			Code: CodeInternalServerError,
-			Msg:  err.Error(),
-		})
+		errorx.WriteOk(w, r, err)
 		return
 	}
 	defer func(localFile *os.File) {
 		err := localFile.Close()
 		if err != nil {
-			httpx.Error(w, err)
-			return
+			logx.Error("Close error:", err.Error())
 		}
 	}(localFile)
 	if _, err = io.Copy(localFile, object); err != nil {
-		httpx.OkJson(w, ResponseData{
-			Code: CodeInternalServerError,
-			Msg:  err.Error(),
-		})
+		errorx.WriteOk(w, r, err)
 		return
 	}
 
-	httpx.OkJson(w, ResponseData{
-		Code: CodeSuccess,
-		Msg:  "success",
-	})
+	errorx.Ok(w, r, nil)
 }
 
 func PutObject(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Access-Control-Allow-Origin", r.Header.Get("Origin"))
-
-	r.ParseMultipartForm(32 << 20) //32M
+	if err := r.ParseMultipartForm(32 << 20); err != nil { //32M
+		logx.Error("ParseMultipartForm error:", err.Error())
+		errorx.WriteOk(w, r, errorx.New(errorx.CodeInternalParamsError))
+		return
+	}
 	mForm := r.MultipartForm
-	bucketName := mForm.Value["bucketName"]
-	// 设置自定义的响应头
-	w.Header().Set("Content-Type", "application/json")
-	res := ResponseData{}
+	bucketname := r.PostFormValue("bucketName")
+	if bucketname == "" {
+		errorx.WriteOk(w, r, errorx.New(errorx.CodeInternalParamsError))
+		return
+	}
+	if !checkPermission(w, r, bucketname, ActionWrite) {
+		return
+	}
+	// 写入前检查全部文件的校验值参数
+	checksums := make(map[string]*Checksum, len(mForm.File))
+	for k := range mForm.File {
+		checksum, err := parseFileChecksum(r, k)
+		if err == ErrChecksumPerFile {
+			errorx.WriteOk(w, r, errorx.WithMsg(errorx.CodeInternalParamsError, errorx.MsgChecksumPerFile))
+			return
+		}
+		if err != nil {
+			errorx.WriteOk(w, r, errorx.WithMsg(errorx.CodeInternalParamsError, errorx.MsgChecksumAlgorithm))
+			return
+		}
+		checksums[k] = checksum
+	}
+	meta, err := parseObjectMeta(r)
+	if err != nil {
+		errorx.WriteOk(w, r, err)
+		return
+	}
 	for k := range mForm.File {
+		checksum := checksums[k]
 		file, fileHeader, err := r.FormFile(k)
 		if err != nil {
-			httpx.OkJson(w, ResponseData{
-				Code: CodeInternalServerError,
-				Msg:  err.Error(),
-			})
+			errorx.WriteOk(w, r, err)
 			return
 		}
 
 		defer file.Close()
-		n, err := client.PutObject(bucketName[0], fileHeader.Filename, file, fileHeader.Size, minio.PutObjectOptions{})
+		if err := checkQuota(bucketname, fileHeader.Size); err != nil {
+			errorx.WriteOk(w, r, err)
+			return
+		}
+		contentType := meta.detectContentType(fileHeader.Filename, fileHeader.Header.Get("Content-Type"), sniffSeeker(file))
+		var sysMeta map[string]string
+		if checksum != nil {
+			sysMeta = checksum.userMetadata()
+		}
+		// 校验失败时不写入，同名文件保持不变
+		n, err := putObjectChecked(bucketname, fileHeader.Filename, file, fileHeader.Size, meta.putOptions(contentType, sysMeta), checksum)
+		if err == ErrChecksumMismatch {
+			logx.Errorf("put object %s %s mismatch", fileHeader.Filename, checksum.Algorithm)
+			errorx.WriteOk(w, r, errorx.New(errorx.CodeChecksumMismatch))
+			return
+		}
 		if err != nil {
-			httpx.OkJson(w, ResponseData{
-				Code: CodeInternalServerError,
-				Msg:  err.Error(),
-			})
+			errorx.WriteOk(w, r, err)
+			return
+		}
+		if err := putObjectTags(bucketname, fileHeader.Filename, meta.Tags); err != nil {
+			errorx.WriteOk(w, r, err)
 			return
 		}
+		if info, err := GetStatObject(bucketname, fileHeader.Filename); err == nil {
+			info.Md5 = removeBackslashAndQuotes(info.Md5)
+			info.Tags = meta.Tags
+			if err := metadata.Save("", info); err != nil {
+				logx.Error("metadata Save error:", err.Error())
+			}
+		}
 
 		logx.Info("Successfully uploaded bytes: ", n)
 	}
-	res.Code = CodeSuccess
-	res.Msg = "Successfully upload"
-	res.Data = nil
-	httpx.OkJson(w, res)
+	errorx.OkMsg(w, r, errorx.MsgUploaded, nil)
 }
 
-// 下载文件
+// 下载文件，流式输出，支持 Range 断点续传和 If-None-Match/If-Modified-Since 条件请求
 func DownLoad(w http.ResponseWriter, r *http.Request) {
-	// r.ParseMultipartForm(32 << 20) //32M
-	bucketname := r.PostFormValue("bucket_name")
-	objectname := r.PostFormValue("object_name")
-	object, err := client.GetObject(bucketname, objectname, minio.GetObjectOptions{})
-	log.Printf("%+v\n", object)
+	bucketname := r.FormValue("bucket_name")
+	objectname := r.FormValue("object_name")
+	if !checkPermission(w, r, bucketname, ActionRead) {
+		return
+	}
+	object, err := store.GetObjectVersion(bucketname, objectname, r.FormValue("version_id"))
 	if err != nil {
-		httpx.Error(w, err)
+		errorx.Write(w, r, err)
 		return
 	}
-	defer func(object *minio.Object) {
-		err := object.Close()
-		if err != nil {
-			httpx.Error(w, err)
-			return
-		}
-	}(object)
-	chunk, err := io.ReadAll(object)
+	defer object.Close()
+
+	// 对象不存在时 GetObject 不会返回错误，需要 Stat 确认
+	stat, err := object.Stat()
 	if err != nil {
-		httpx.Error(w, err)
+		errorx.Write(w, r, err)
 		return
 	}
-	w.Header().Set("Content-Type", "application/octet-stream")
-	w.Header().Set("Content-Disposition", "attachement;filename=\""+objectname+"\"")
-	w.Write(chunk)
+	serveObject(w, r, object, stat, objectname)
 }
 
-// 分片上传
+// 分片上传，GET 请求查询已上传的分片(simple-uploader testChunks)
 func Upload(w http.ResponseWriter, r *http.Request) {
-	res := ResponseData{}
+	if r.Method == http.MethodGet {
+		UploadStatus(w, r)
+		return
+	}
 	if err := r.ParseMultipartForm(32 << 20); err != nil { //32M
 		logx.Errorf("Cannot ParseMultipartForm, error: %v\n", err)
-		res.Code = CodeInternalParamsError
-		res.Msg = CodeInternalParamsError.Msg()
-		httpx.OkJson(w, res)
+		errorx.WriteOk(w, r, errorx.New(errorx.CodeInternalParamsError))
 		return
 	}
-	mForm := r.MultipartForm
 	// 获取存储桶名
-	bucketname := mForm.Value["BucketName"][0]
+	bucketname := r.PostFormValue("BucketName")
+	if !checkPermission(w, r, bucketname, ActionWrite) {
+		return
+	}
 	// 获取文件md值
-	identifier := mForm.Value["identifier"][0]
-	// 分片规格
-	chunkSize := mForm.Value["chunkSize"][0]
-	// 当前分片索引
-	chunkNumber := mForm.Value["chunkNumber"][0]
+	identifier := r.PostFormValue("identifier")
 	// 文件名
-	filename := mForm.Value["filename"][0]
-	// 总分片
-	totalChunks := mForm.Value["totalChunks"][0]
+	filename := r.PostFormValue("filename")
+	// 分片规格
+	chunk_size, err := strconv.ParseInt(r.PostFormValue("chunkSize"), 10, 64)
+	if err != nil || chunk_size <= 0 {
+		errorx.WriteOk(w, r, errorx.WithMsg(errorx.CodeInternalParamsError, errorx.MsgInvalidChunkSize))
+		return
+	}
 	// 文件总大小
-	totalSize := mForm.Value["totalSize"][0]
-	total_size, err := strconv.ParseInt(totalSize, 10, 64)
+	total_size, err := strconv.ParseInt(r.PostFormValue("totalSize"), 10, 64)
 	if err != nil {
-		res.Code = CodeInternalParamsError
-		res.Msg = "Parse Invalid total size"
-		httpx.OkJson(w, res)
+		errorx.WriteOk(w, r, errorx.WithMsg(errorx.CodeInternalParamsError, errorx.MsgInvalidTotalSize))
 		return
 	}
-	total_chunks, err := strconv.Atoi(totalChunks)
+	// 总分片
+	total_chunks, err := strconv.Atoi(r.PostFormValue("totalChunks"))
 	if err != nil {
 		logx.Error("total_chunks parse err:", err)
-		res.Code = CodeInternalParamsError
-		res.Msg = CodeInternalParamsError.Msg()
-		httpx.OkJson(w, res)
+		errorx.WriteOk(w, r, errorx.New(errorx.CodeInternalParamsError))
+		return
+	}
+	// 当前分片索引
+	chunk_number, err := strconv.Atoi(r.PostFormValue("chunkNumber"))
+	if err != nil || chunk_number <= 0 || chunk_number > total_chunks {
+		logx.Error("chunk_number parse err:", err)
+		errorx.WriteOk(w, r, errorx.New(errorx.CodeInternalParamsError))
+		return
+	}
+
+	// 分片校验值
+	checksum, err := parseChecksum(r)
+	if err != nil {
+		errorx.WriteOk(w, r, errorx.WithMsg(errorx.CodeInternalParamsError, errorx.MsgChecksumAlgorithm))
+		return
+	}
+	// 对象属性，以创建会话的分片为准
+	meta, err := parseObjectMeta(r)
+	if err != nil {
+		errorx.WriteOk(w, r, err)
 		return
 	}
 
@@ -399,10 +441,7 @@ func Upload(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		logx.Error("GetInfoForIdentifier:%s\n", err.Error())
 	} else {
-		res.Code = CodeSuccess
-		res.Msg = "GetInfoForIdentifier:文件已在系统内:秒传成功！"
-		res.Data = info
-		httpx.OkJson(w, res)
+		errorx.OkMsg(w, r, errorx.MsgInstantUpload, info)
 		return
 	}
 
@@ -413,10 +452,7 @@ func Upload(w http.ResponseWriter, r *http.Request) {
 	} else if identifier != info.Md5 {
 		filename = identifier + "-" + filename
 	} else if identifier == info.Md5 {
-		res.Code = CodeSuccess
-		res.Msg = "GetFileSaveInfo:文件已在系统内:秒传成功！"
-		res.Data = info
-		httpx.OkJson(w, res)
+		errorx.OkMsg(w, r, errorx.MsgInstantUpload, info)
 		return
 	}
 
@@ -424,159 +460,164 @@ func Upload(w http.ResponseWriter, r *http.Request) {
 	isExist, _ := IsBuckets(bucketname)
 	if !isExist {
 		logx.Error("err:检查桶状态：不存在的存储桶")
-		res.Code = CodeInternalParamsError
-		res.Msg = CodeInternalParamsError.Msg()
-		httpx.OkJson(w, res)
+		errorx.WriteOk(w, r, errorx.New(errorx.CodeBucketNotFound))
 		return
 	}
 
-	// 已完成上传的大小
-	var have_uploaded_size int64 = 0
-	// 已完成上传的分片
-	var have_uploaded_count int64 = 0
-	doneCh := make(chan struct{})
-	defer close(doneCh)
-
-	// 初始化map
-	if _, ok := is_exists_key[identifier+"_"+chunkSize]; !ok {
-		is_exists_key[identifier+"_"+chunkSize] = make(map[string]bool)
+	// 创建或恢复上传会话
+	session, err := sessions.Create(&UploadSession{
+		Identifier:  identifier,
+		BucketName:  bucketname,
+		Filename:    filename,
+		ChunkSize:   chunk_size,
+		TotalChunks: total_chunks,
+		TotalSize:   total_size,
+		Meta:        meta,
+	})
+	if err != nil {
+		logx.Error("sessions.Create error:", err.Error())
+		errorx.WriteOk(w, r, errorx.New(errorx.CodeInternalServerError))
+		return
 	}
+	key := session.Key()
 
-reUpload:
-	_, err = GetInfoForIdentifier(identifier)
-	if is_exist, ok := is_exists_key[identifier+"_"+chunkSize][chunkNumber+".part"]; err != nil && (!ok || !is_exist) {
+	// 上传当前分片，其他实例已接收的分片直接跳过
+	if !hasChunk(session.Chunks, chunk_number) {
 		logx.Info("开始上传分片！")
-		for k := range mForm.File {
-			file, fileHeader, err := r.FormFile(k)
-			if err != nil {
-				res.Code = CodeInternalServerError
-				res.Msg = CodeInternalServerError.Msg()
-				httpx.OkJson(w, res)
-				return
-			}
-
-			defer file.Close()
-			n, err := client.PutObject(bucketname, identifier+"_"+chunkSize+"/"+chunkNumber+".part", file, fileHeader.Size, minio.PutObjectOptions{})
-			if err != nil {
-				httpx.Error(w, err)
-				return
-			}
-			// 标记上传分片
-			mu.Lock()
-			if _, ok := is_exists_key[identifier+"_"+chunkSize]; !ok {
-				is_exists_key[identifier+"_"+chunkSize] = make(map[string]bool)
-				is_exists_key[identifier+"_"+chunkSize][chunkNumber+".part"] = true
-			}
-			mu.Unlock()
-
-			logx.Info("Successfully uploaded bytes: ", n)
+		if err := putChunk(r, bucketname, session, chunk_number, checksum); err != nil {
+			errorx.WriteOk(w, r, chunkError(err))
+			return
 		}
 	}
-	shardPaths := make([]SrcInfo, 0)
-	// 文件上传完成
-	finished := false
-	// 检查当前分片是否成功上传到临时文件
-	isUploaded := false
-
-	// 查询已上传的分片文件
-	for message := range client.ListObjects(bucketname, identifier+"_"+chunkSize, true, doneCh) {
-		arr := strings.Split(message.Key, "/")
-		tmp_name := ""
-		park_name := ""
-		if len(arr) >= 1 {
-			tmp_name = arr[1]
-			key_arr := strings.Split(tmp_name, ".")
-			if len(key_arr) >= 1 {
-				park_name = key_arr[0]
-			}
-		}
-		// 标记分片已上传状态
-		if park_name == chunkNumber {
-			isUploaded = true
-		}
 
-		if v, err := strconv.Atoi(park_name); err == nil && v > 0 && v <= total_chunks {
-			shardPaths = append(shardPaths, SrcInfo{
-				Name: message.Key,
-				Etag: message.ETag,
-			})
-			have_uploaded_count += 1
-			have_uploaded_size += message.Size
+	// 查询已上传的分片文件，检查当前分片是否成功上传到临时文件
+	var shardPaths []SrcInfo
+	var have_uploaded_size int64
+	for retry := 0; ; retry++ {
+		var isUploaded bool
+		shardPaths, have_uploaded_size, isUploaded = listChunks(bucketname, key, chunk_number, total_chunks)
+		if isUploaded {
+			break
 		}
-		res.Code = CodeSuccess
-		res.Msg = "继续上传"
-		if _, ok := muxing[identifier]; !ok {
-			muxing[identifier] = false
+		// 丢失临时文件
+		if retry >= 4 {
+			errorx.WriteOk(w, r, errorx.WithMsg(errorx.CodeInternalServerError, errorx.MsgUploadFailed))
+			return
 		}
-		// 合并临时文件
-		if have_uploaded_size == total_size && int(have_uploaded_count) == total_chunks && !muxing[identifier] {
-			muxing[identifier] = true
-			logx.Info("开始合并")
-			err := ComposeObject(bucketname, filename, identifier, shardPaths)
-			// 文件合并失败
-			if err != nil {
-				res.Msg = "merge file error: " + err.Error()
-				res.Code = CodeInternalServerError
-				muxing[identifier] = false
-				httpx.OkJson(w, res)
-				return
-			} else {
-				// 完成上传
-				finished = true
-			}
+		logx.Error("临时文件丢失，正在重新上传！")
+		sessions.RemoveChunk(key, chunk_number)
+		if err := putChunk(r, bucketname, session, chunk_number, checksum); err != nil {
+			errorx.WriteOk(w, r, chunkError(err))
+			return
 		}
 	}
 
-	// 重试计数
-	retry := 0
-	// 丢失临时文件
-	if !isUploaded {
-		logx.Error("临时文件丢失，正在重新上传！")
-		delete(is_exists_key[identifier+"_"+chunkSize], chunkNumber+".part")
-		retry++
-		if retry > 4 {
-			res.Code = CodeInternalServerError
-			res.Msg = "上传失败"
-			httpx.OkJson(w, res)
-			return
+	if have_uploaded_size != total_size || len(shardPaths) != total_chunks {
+		errorx.OkMsg(w, r, errorx.MsgContinueUpload, nil)
+		return
+	}
+
+	// 合并临时文件，合并锁保证多个实例只有一个执行合并
+	token, err := sessions.AcquireMerge(key)
+	if err != nil || token == "" {
+		errorx.OkMsg(w, r, errorx.MsgContinueUpload, nil)
+		return
+	}
+	defer sessions.ReleaseMerge(key, token)
+	sessions.SetState(key, SessionMerging)
+
+	logx.Info("开始合并")
+	// 合并前读取最新会话，包含其他实例计入的文件摘要
+	if latest, err := sessions.Get(key); err == nil {
+		session = latest
+	}
+	info, err = mergeChunks(bucketname, filename, identifier, shardPaths, session)
+	if err == ErrChecksumMismatch {
+		sessions.SetState(key, SessionFailed)
+		sessions.Delete(key)
+		errorx.WriteOk(w, r, errorx.New(errorx.CodeChecksumMismatch))
+		return
+	}
+	if err != nil {
+		sessions.SetState(key, SessionUploading)
+		errorx.WriteOk(w, r, err)
+		return
+	}
+
+	logx.Info("Finished")
+	sessions.SetState(key, SessionFinished)
+	sessions.Delete(key)
+	errorx.Ok(w, r, info)
+}
+
+type UploadStatusInfo struct {
+	// 文件已在系统内，无需上传
+	SkipUpload bool `json:"skipUpload"`
+	// 已上传的分片编号
+	Uploaded []int         `json:"uploaded"`
+	State    string        `json:"state,omitempty"`
+	Info     *FileSaveInfo `json:"info,omitempty"`
+}
+
+// 查询分片上传状态，客户端据此跳过已上传的分片
+func UploadStatus(w http.ResponseWriter, r *http.Request) {
+	bucketname := r.FormValue("BucketName")
+	if !checkPermission(w, r, bucketname, ActionWrite) {
+		return
+	}
+	identifier := r.FormValue("identifier")
+	chunk_size, err := strconv.ParseInt(r.FormValue("chunkSize"), 10, 64)
+	if err != nil || chunk_size <= 0 || identifier == "" {
+		errorx.WriteOk(w, r, errorx.New(errorx.CodeInternalParamsError))
+		return
+	}
+	total_chunks, err := strconv.Atoi(r.FormValue("totalChunks"))
+	if err != nil {
+		errorx.WriteOk(w, r, errorx.New(errorx.CodeInternalParamsError))
+		return
+	}
+
+	// 秒传
+	if info, err := GetInfoForIdentifier(identifier); err == nil {
+		errorx.Ok(w, r, UploadStatusInfo{SkipUpload: true, Uploaded: []int{}, Info: info})
+		return
+	}
+
+	status := UploadStatusInfo{Uploaded: []int{}}
+	key := sessionKey(identifier, chunk_size)
+	session, err := sessions.Get(key)
+	if err != nil && err != ErrSessionNotFound {
+		logx.Error("sessions.Get error:", err.Error())
+	}
+
+	// 以实际存在的分片对象为准，会话中有记录但对象已丢失的分片需要重新上传
+	shardPaths, _, _ := listChunks(bucketname, key, 0, total_chunks)
+	stored := make(map[int]bool, len(shardPaths))
+	for _, v := range shardPaths {
+		if n, ok := parseChunkNumber(v.Name); ok {
+			stored[n] = true
 		}
-		goto reUpload
 	}
+	status.Uploaded = sortedChunks(stored)
 
-	// 检查文件是否已经合并完成
-	if finished {
-		logx.Info("Finished")
-		// 删除临时文件
-		removeObjectList(shardPaths, bucketname)
-		// 检查文件
-		info, err := GetStatObject(bucketname, filename)
-		if err != nil {
-			logx.Error("查询上传记录:%s\n", err.Error())
-			finished = false
-			muxing[identifier] = false
-			res.Code = CodeInternalServerError
-			res.Msg = CodeInternalServerError.Msg()
-			res.Data = nil
-		} else {
-			// 标记md5值，后续处理相同md5值的文件
-			err := redisdb.Set(identifier, info, 0).Err()
-			if err != nil {
-				logx.Info("Set Error：", err.Error())
+	if session != nil {
+		status.State = session.State
+		for _, n := range session.Chunks {
+			if !stored[n] {
+				sessions.RemoveChunk(key, n)
 			}
-
-			// 标记桶名、文件名,后续处理同名但是MD5值不同的文件
-			err = redisdb.HSet(bucketname, filename, info).Err()
-			if err != nil {
-				logx.Info("HSet Error：", err.Error())
+		}
+		for _, v := range shardPaths {
+			if n, _ := parseChunkNumber(v.Name); !hasChunk(session.Chunks, n) {
+				// 分片对象的 ETag 即上传时计算的md5
+				md5 := ""
+				if etag := removeBackslashAndQuotes(v.Etag); isMd5(etag) {
+					md5 = etag
+				}
+				sessions.AddChunk(key, n, md5, nil)
 			}
-
-			res.Code = CodeSuccess
-			res.Msg = CodeSuccess.Msg()
-			res.Data = info
-			delete(is_exists_key, identifier+"_"+chunkSize)
-			delete(muxing, identifier)
 		}
 	}
 
-	httpx.OkJson(w, res)
+	errorx.Ok(w, r, status)
 }
@@ -0,0 +1,278 @@
+package common
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+	"minio_demo/errorx"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/minio/minio-go"
+	"github.com/zituocn/logx"
+)
+
+type MultipartInfo struct {
+	BucketName string `json:"bucket_name"`
+	ObjectName string `json:"object_name"`
+	UploadId   string `json:"upload_id"`
+}
+
+type PartInfo struct {
+	PartNumber int    `json:"part_number"`
+	ETag       string `json:"etag"`
+	Size       int64  `json:"size,omitempty"`
+}
+
+// 初始化分段上传
+func InitiateMultipartUpload(w http.ResponseWriter, r *http.Request) {
+	bucketname := r.PostFormValue("bucket_name")
+	objectname := r.PostFormValue("object_name")
+	if !checkPermission(w, r, bucketname, ActionWrite) {
+		return
+	}
+	if bucketname == "" || objectname == "" {
+		errorx.WriteOk(w, r, errorx.New(errorx.CodeInternalParamsError))
+		return
+	}
+	// 分段上传完成前不计入已用容量，按客户端声明的文件大小 total_size 检查配额
+	totalSize, err := parseSize(r.PostFormValue("total_size"))
+	if err != nil {
+		errorx.WriteOk(w, r, errorx.New(errorx.CodeInternalParamsError))
+		return
+	}
+	if err := checkQuota(bucketname, totalSize); err != nil {
+		errorx.WriteOk(w, r, err)
+		return
+	}
+
+	uploadId, err := store.NewMultipartUpload(bucketname, objectname, minio.PutObjectOptions{})
+	if err != nil {
+		logx.Error("NewMultipartUpload error:", err.Error())
+		errorx.WriteOk(w, r, err)
+		return
+	}
+	// 会话记录分段md5和文件摘要，创建失败时完成上传需要重新读取文件校验
+	if _, err := sessions.Create(&UploadSession{UploadId: uploadId, BucketName: bucketname, Filename: objectname}); err != nil {
+		logx.Error("sessions.Create error:", err.Error())
+	}
+
+	errorx.Ok(w, r, MultipartInfo{
+		BucketName: bucketname,
+		ObjectName: objectname,
+		UploadId:   uploadId,
+	})
+}
+
+// 上传分段
+func UploadPart(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(32 << 20); err != nil { //32M
+		logx.Errorf("Cannot ParseMultipartForm, error: %v\n", err)
+		errorx.WriteOk(w, r, errorx.New(errorx.CodeInternalParamsError))
+		return
+	}
+	bucketname := r.PostFormValue("bucket_name")
+	objectname := r.PostFormValue("object_name")
+	if !checkPermission(w, r, bucketname, ActionWrite) {
+		return
+	}
+	uploadId := r.PostFormValue("upload_id")
+	partNumber, err := strconv.Atoi(r.PostFormValue("part_number"))
+	// S3 分段编号范围为 1-10000
+	if err != nil || partNumber < 1 || partNumber > 10000 || uploadId == "" {
+		errorx.WriteOk(w, r, errorx.WithMsg(errorx.CodeInternalParamsError, errorx.MsgInvalidPartNumber))
+		return
+	}
+
+	for k := range r.MultipartForm.File {
+		file, fileHeader, err := r.FormFile(k)
+		if err != nil {
+			errorx.WriteOk(w, r, err)
+			return
+		}
+		defer file.Close()
+
+		// 上传时计算分段md5，分段按顺序到达时同时计入文件摘要
+		key := multipartSessionKey(uploadId)
+		session, _ := sessions.Get(key)
+		md5Hash := md5.New()
+		var writer io.Writer = md5Hash
+		var fileHash hash.Hash
+		if session != nil {
+			if fileHash = resumeDigest(session.Digest, partNumber); fileHash != nil {
+				writer = io.MultiWriter(md5Hash, fileHash)
+			}
+		}
+		part, err := store.PutObjectPart(bucketname, objectname, uploadId, partNumber, io.TeeReader(file, writer), fileHeader.Size)
+		if err != nil {
+			logx.Error("PutObjectPart error:", err.Error())
+			errorx.WriteOk(w, r, err)
+			return
+		}
+		if session != nil {
+			digest := advanceDigest(session.Digest, fileHash, partNumber, part.Size)
+			if err := sessions.AddChunk(key, partNumber, hex.EncodeToString(md5Hash.Sum(nil)), digest); err != nil {
+				logx.Error("sessions.AddChunk error:", err.Error())
+			}
+		}
+
+		errorx.Ok(w, r, PartInfo{
+			PartNumber: part.PartNumber,
+			ETag:       removeBackslashAndQuotes(part.ETag),
+			Size:       part.Size,
+		})
+		return
+	}
+
+	errorx.WriteOk(w, r, errorx.WithMsg(errorx.CodeInternalParamsError, errorx.MsgFileRequired))
+}
+
+// 完成分段上传，parts 为空时使用服务端已接收的全部分段
+func CompleteMultipartUpload(w http.ResponseWriter, r *http.Request) {
+	bucketname := r.PostFormValue("bucket_name")
+	objectname := r.PostFormValue("object_name")
+	if !checkPermission(w, r, bucketname, ActionWrite) {
+		return
+	}
+	uploadId := r.PostFormValue("upload_id")
+	// 客户端计算的文件md5，用于秒传
+	identifier := r.PostFormValue("identifier")
+
+	parts := make([]PartInfo, 0)
+	if v := r.PostFormValue("parts"); v != "" {
+		if err := json.Unmarshal([]byte(v), &parts); err != nil {
+			errorx.WriteOk(w, r, errorx.WithMsg(errorx.CodeInternalParamsError, errorx.MsgInvalidParts))
+			return
+		}
+	} else {
+		uploaded, err := store.ListObjectParts(bucketname, objectname, uploadId)
+		if err != nil {
+			logx.Error("ListObjectParts error:", err.Error())
+			errorx.WriteOk(w, r, err)
+			return
+		}
+		for _, v := range uploaded {
+			parts = append(parts, PartInfo{PartNumber: v.PartNumber, ETag: v.ETag})
+		}
+	}
+	if len(parts) == 0 {
+		errorx.WriteOk(w, r, errorx.WithMsg(errorx.CodeInternalParamsError, errorx.MsgNoPartsUploaded))
+		return
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].PartNumber < parts[j].PartNumber })
+
+	key := multipartSessionKey(uploadId)
+	session, _ := sessions.Get(key)
+	// 全部分段都已计入文件摘要时在完成前校验，不一致时不写入，同名文件保持不变
+	verified := isMd5(strings.ToLower(identifier))
+	check := verified
+	h, offset := partsDigest(session, parts)
+	if check && h != nil && offset < 0 {
+		if sum := hex.EncodeToString(h.Sum(nil)); sum != strings.ToLower(identifier) {
+			logx.Errorf("upload %s md5 mismatch: %s != %s", uploadId, sum, identifier)
+			errorx.WriteOk(w, r, errorx.New(errorx.CodeChecksumMismatch))
+			return
+		}
+		check = false
+	}
+
+	complete := make([]minio.CompletePart, 0, len(parts))
+	for _, v := range parts {
+		complete = append(complete, minio.CompletePart{PartNumber: v.PartNumber, ETag: v.ETag})
+	}
+	if _, err := store.CompleteMultipartUpload(bucketname, objectname, uploadId, complete); err != nil {
+		logx.Error("CompleteMultipartUpload error:", err.Error())
+		errorx.WriteOk(w, r, err)
+		return
+	}
+	sessions.Delete(key)
+
+	// 其余情况完成后读取未计入摘要的部分校验，不一致时删除文件
+	if check {
+		if h == nil {
+			h, offset = md5.New(), 0
+		}
+		if err := readMd5(h, bucketname, objectname, offset); err != nil {
+			logx.Error("readMd5 error:", err.Error())
+			errorx.WriteOk(w, r, errorx.New(errorx.CodeInternalServerError))
+			return
+		}
+		if sum := hex.EncodeToString(h.Sum(nil)); sum != strings.ToLower(identifier) {
+			logx.Errorf("object %s/%s md5 mismatch: %s != %s", bucketname, objectname, sum, identifier)
+			store.RemoveObject(bucketname, objectname)
+			errorx.WriteOk(w, r, errorx.New(errorx.CodeChecksumMismatch))
+			return
+		}
+	}
+
+	info, err := GetStatObject(bucketname, objectname)
+	if err != nil {
+		errorx.WriteOk(w, r, errorx.New(errorx.CodeInternalServerError))
+		return
+	}
+	// 只有校验通过的md5才能用于秒传
+	if !verified {
+		identifier = ""
+	} else {
+		info.Md5 = identifier
+	}
+	if err := metadata.Save(identifier, info); err != nil {
+		logx.Info("metadata Save Error：", err.Error())
+	}
+
+	errorx.Ok(w, r, info)
+}
+
+// 会话摘要对应的分段，返回恢复的摘要和已计入的字节数，全部分段都已计入时 offset 为 -1
+// 摘要不能使用时返回 nil
+func partsDigest(session *UploadSession, parts []PartInfo) (hash.Hash, int64) {
+	if session == nil || session.Digest == nil || len(parts) < session.Digest.Chunks {
+		return nil, 0
+	}
+	etags := make([]string, 0, len(parts))
+	for i, v := range parts {
+		// 只有从 1 开始连续的分段才能按顺序计入摘要
+		if i < session.Digest.Chunks && v.PartNumber != i+1 {
+			return nil, 0
+		}
+		etags = append(etags, v.ETag)
+	}
+	if !digestUsable(session, etags) {
+		return nil, 0
+	}
+	h := resumeDigest(session.Digest, session.Digest.Chunks+1)
+	if h == nil {
+		return nil, 0
+	}
+	if session.Digest.Chunks == len(parts) {
+		return h, -1
+	}
+	return h, session.Digest.Size
+}
+
+// 取消分段上传，已上传的分段会被服务端清理
+func AbortMultipartUpload(w http.ResponseWriter, r *http.Request) {
+	bucketname := r.PostFormValue("bucket_name")
+	objectname := r.PostFormValue("object_name")
+	if !checkPermission(w, r, bucketname, ActionWrite) {
+		return
+	}
+	uploadId := r.PostFormValue("upload_id")
+	if bucketname == "" || objectname == "" || uploadId == "" {
+		errorx.WriteOk(w, r, errorx.New(errorx.CodeInternalParamsError))
+		return
+	}
+
+	if err := store.AbortMultipartUpload(bucketname, objectname, uploadId); err != nil {
+		logx.Error("AbortMultipartUpload error:", err.Error())
+		errorx.WriteOk(w, r, err)
+		return
+	}
+	sessions.Delete(multipartSessionKey(uploadId))
+
+	errorx.Ok(w, r, nil)
+}
@@ -0,0 +1,172 @@
+package common
+
+import (
+	"encoding/json"
+	"io"
+	"mime"
+	"minio_demo/errorx"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/minio/minio-go"
+	"github.com/zituocn/logx"
+)
+
+// S3 对象标签和自定义元数据限制
+const (
+	maxObjectTags    = 10
+	maxUserMetaBytes = 2048
+	userMetaPrefix   = "x-amz-meta-"
+)
+
+// 未指定类型且无法识别时使用的类型
+const defaultContentType = "application/octet-stream"
+
+// 上传时指定的对象属性
+type ObjectMeta struct {
+	// 为空时按文件扩展名和文件内容识别
+	ContentType string            `json:"content_type,omitempty"`
+	UserMeta    map[string]string `json:"user_meta,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+}
+
+// 从表单字段 content_type、x-amz-meta-*、tags(json 对象) 读取对象属性，
+// 与请求头中的属性合并，同名时表单字段优先
+func parseObjectMeta(r *http.Request) (*ObjectMeta, error) {
+	invalid := errorx.WithMsg(errorx.CodeInternalParamsError, errorx.MsgInvalidObjectMeta)
+	meta, err := parseObjectMetaHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	meta.ContentType = r.PostFormValue("content_type")
+	for k, v := range userMetadata(http.Header(r.PostForm)) {
+		meta.UserMeta[k] = v
+	}
+	if v := r.PostFormValue("tags"); v != "" {
+		meta.Tags = nil
+		if err := json.Unmarshal([]byte(v), &meta.Tags); err != nil {
+			return nil, invalid
+		}
+	}
+	if !validTags(meta.Tags, maxObjectTags) || !validUserMeta(meta.UserMeta) {
+		return nil, invalid
+	}
+	return meta, nil
+}
+
+// 从请求头 X-Amz-Meta-*、X-Amz-Tagging(url 查询串格式) 读取对象属性
+// 请求体即文件内容时不能解析表单，类型由调用方从 Content-Type 读取
+func parseObjectMetaHeader(r *http.Request) (*ObjectMeta, error) {
+	invalid := errorx.WithMsg(errorx.CodeInternalParamsError, errorx.MsgInvalidObjectMeta)
+	meta := &ObjectMeta{UserMeta: userMetadata(r.Header)}
+	if v := r.Header.Get("X-Amz-Tagging"); v != "" {
+		query, err := url.ParseQuery(v)
+		if err != nil {
+			return nil, invalid
+		}
+		meta.Tags = make(map[string]string, len(query))
+		for k := range query {
+			meta.Tags[k] = query.Get(k)
+		}
+	}
+	if !validTags(meta.Tags, maxObjectTags) || !validUserMeta(meta.UserMeta) {
+		return nil, invalid
+	}
+	return meta, nil
+}
+
+// 标签数量不超过 max，key 为 1-128 个字符，value 不超过 256 个字符
+func validTags(tags map[string]string, max int) bool {
+	if len(tags) > max {
+		return false
+	}
+	for k, v := range tags {
+		if k == "" || len(k) > maxBucketTagKey || len(v) > maxBucketTagValue {
+			return false
+		}
+	}
+	return true
+}
+
+// 自定义元数据总大小不超过 2KB，key 只能包含请求头允许的字符
+func validUserMeta(userMeta map[string]string) bool {
+	size := 0
+	for k, v := range userMeta {
+		if k == "" || strings.ContainsAny(k, " \t\r\n:") || strings.ContainsAny(v, "\r\n") {
+			return false
+		}
+		size += len(k) + len(v)
+	}
+	return size <= maxUserMetaBytes
+}
+
+// 确定对象类型：指定的类型、文件上传时的类型、扩展名、文件内容
+// sniff 返回文件开头的内容，只在前面都无法确定时调用
+func (meta *ObjectMeta) detectContentType(filename, partType string, sniff func() []byte) string {
+	if meta.ContentType != "" {
+		return meta.ContentType
+	}
+	if partType != "" && partType != defaultContentType {
+		return partType
+	}
+	if t := mime.TypeByExtension(path.Ext(filename)); t != "" {
+		return t
+	}
+	if sniff != nil {
+		if head := sniff(); len(head) > 0 {
+			return http.DetectContentType(head)
+		}
+	}
+	return defaultContentType
+}
+
+// 读取文件开头用于识别类型，读取后回到文件开头
+func sniffSeeker(reader io.ReadSeeker) func() []byte {
+	return func() []byte {
+		head := make([]byte, 512)
+		n, _ := io.ReadFull(reader, head)
+		reader.Seek(0, io.SeekStart)
+		return head[:n]
+	}
+}
+
+// 上传参数，checksum 等系统元数据与自定义元数据合并
+func (meta *ObjectMeta) putOptions(contentType string, sysMeta map[string]string) minio.PutObjectOptions {
+	opts := minio.PutObjectOptions{
+		ContentType:  contentType,
+		UserMetadata: make(map[string]string, len(meta.UserMeta)+len(sysMeta)),
+	}
+	for k, v := range meta.UserMeta {
+		opts.UserMetadata[k] = v
+	}
+	for k, v := range sysMeta {
+		opts.UserMetadata[k] = v
+	}
+	return opts
+}
+
+// 写入对象标签，失败时删除对象，避免留下缺少标签的对象
+func putObjectTags(bucketname, objectname string, tags map[string]string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	if err := store.SetObjectTagging(bucketname, objectname, tags); err != nil {
+		logx.Errorf("set tags %s/%s %v", bucketname, objectname, err)
+		store.RemoveObject(bucketname, objectname)
+		return err
+	}
+	return nil
+}
+
+// 请求头或对象元数据中的自定义元数据，去掉 X-Amz-Meta- 前缀，key 转为小写
+func userMetadata(header http.Header) map[string]string {
+	userMeta := make(map[string]string)
+	for k, v := range header {
+		if name := strings.ToLower(k); strings.HasPrefix(name, userMetaPrefix) && len(v) > 0 {
+			userMeta[name[len(userMetaPrefix):]] = v[0]
+		}
+	}
+	return userMeta
+}
@@ -0,0 +1,97 @@
+package common
+
+import (
+	"minio_demo/config"
+	"minio_demo/errorx"
+	"minio_demo/middleware"
+	"net/http"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/zituocn/logx"
+)
+
+const (
+	ActionList   = "list"
+	ActionRead   = "read"
+	ActionWrite  = "write"
+	ActionDelete = "delete"
+	ActionAdmin  = "admin"
+)
+
+// 文件记录存储中的策略缓存时间
+const policyCacheTTL = 30 * time.Second
+
+var policyCache struct {
+	mu       sync.Mutex
+	policies []config.Policy
+	loadedAt time.Time
+}
+
+// 配置文件策略与文件记录存储中的策略
+func loadPolicies() []config.Policy {
+	policyCache.mu.Lock()
+	defer policyCache.mu.Unlock()
+	if time.Since(policyCache.loadedAt) > policyCacheTTL {
+		stored, err := metadata.ListPolicies()
+		if err != nil {
+			logx.Error("ListPolicies error:", err.Error())
+		} else {
+			policyCache.policies = stored
+			policyCache.loadedAt = time.Now()
+		}
+	}
+	policies := make([]config.Policy, 0, len(config.ConfData.Policies)+len(policyCache.policies))
+	policies = append(policies, config.ConfData.Policies...)
+	return append(policies, policyCache.policies...)
+}
+
+func policyAllows(policy config.Policy, principal, bucketname, action string) bool {
+	if policy.Principal != "*" && policy.Principal != principal {
+		return false
+	}
+	matched := false
+	for _, pattern := range policy.Buckets {
+		if ok, _ := path.Match(pattern, bucketname); ok {
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		return false
+	}
+	for _, v := range policy.Actions {
+		if v == action || v == ActionAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// 调用方是否有桶的操作权限，未开启认证时不做限制
+func authorize(r *http.Request, bucketname, action string) bool {
+	if !config.ConfData.Auth.Enabled {
+		return true
+	}
+	principal := middleware.PrincipalFrom(r.Context())
+	if principal == nil {
+		return false
+	}
+	for _, policy := range loadPolicies() {
+		if policyAllows(policy, principal.Name, bucketname, action) {
+			return true
+		}
+	}
+	return false
+}
+
+// 检查权限，没有权限时写入响应并返回 false
+func checkPermission(w http.ResponseWriter, r *http.Request, bucketname, action string) bool {
+	if authorize(r, bucketname, action) {
+		return true
+	}
+	logx.Notice("permission denied: bucket:" + bucketname + " action:" + action)
+	errorx.WriteOk(w, r, errorx.New(errorx.CodeForbidden))
+	return false
+}
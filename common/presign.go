@@ -0,0 +1,184 @@
+package common
+
+import (
+	"minio_demo/config"
+	"minio_demo/errorx"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/minio/minio-go"
+)
+
+// S3 预签名地址最长有效期为 7 天
+const maxPresignExpiry = 7 * 24 * time.Hour
+
+type PresignedInfo struct {
+	Url       string `json:"url"`
+	Method    string `json:"method"`
+	ExpiresAt string `json:"expiresAt"`
+	// POST 表单上传时需要一并提交的字段
+	FormData map[string]string `json:"formData,omitempty"`
+}
+
+// 解析有效期参数，未指定时使用默认值，超出上限时返回 false
+func presignExpiry(r *http.Request) (time.Duration, bool) {
+	limit := time.Duration(config.ConfData.Presign.MaxExpiry) * time.Second
+	if limit <= 0 || limit > maxPresignExpiry {
+		limit = maxPresignExpiry
+	}
+	expires := time.Duration(config.ConfData.Presign.DefaultExpiry) * time.Second
+	if expires <= 0 {
+		expires = 15 * time.Minute
+	}
+	if v := r.FormValue("expires"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return 0, false
+		}
+		expires = time.Duration(n) * time.Second
+	}
+	if expires > limit {
+		return 0, false
+	}
+	return expires, true
+}
+
+// 预签名下载地址
+func PresignedGetObject(w http.ResponseWriter, r *http.Request) {
+	bucketname := r.FormValue("bucket_name")
+	objectname := r.FormValue("object_name")
+	if !checkPermission(w, r, bucketname, ActionRead) {
+		return
+	}
+	expires, ok := presignExpiry(r)
+	if !ok || bucketname == "" || objectname == "" {
+		errorx.WriteOk(w, r, errorx.New(errorx.CodeInternalParamsError))
+		return
+	}
+	// 只为存在的对象签发下载地址
+	if _, err := GetStatObject(bucketname, objectname); err != nil {
+		errorx.WriteOk(w, r, errorx.New(errorx.CodeObjectNotFound))
+		return
+	}
+
+	// 下载时使用原始文件名
+	reqParams := make(url.Values)
+	reqParams.Set("response-content-disposition", contentDisposition("attachment", path.Base(objectname)))
+	u, err := store.PresignedGetObject(bucketname, objectname, expires, reqParams)
+	if err != nil {
+		errorx.WriteOk(w, r, err)
+		return
+	}
+
+	errorx.Ok(w, r, PresignedInfo{
+		Url:       u.String(),
+		Method:    http.MethodGet,
+		ExpiresAt: time.Now().Add(expires).Format("2006-01-02 15:04:05"),
+	})
+}
+
+// 预签名上传地址
+func PresignedPutObject(w http.ResponseWriter, r *http.Request) {
+	bucketname := r.FormValue("bucket_name")
+	objectname := r.FormValue("object_name")
+	if !checkPermission(w, r, bucketname, ActionWrite) {
+		return
+	}
+	expires, ok := presignExpiry(r)
+	if !ok || bucketname == "" || objectname == "" {
+		errorx.WriteOk(w, r, errorx.New(errorx.CodeInternalParamsError))
+		return
+	}
+	if isExist, _ := IsBuckets(bucketname); !isExist {
+		errorx.WriteOk(w, r, errorx.New(errorx.CodeBucketNotFound))
+		return
+	}
+
+	u, err := store.PresignedPutObject(bucketname, objectname, expires)
+	if err != nil {
+		errorx.WriteOk(w, r, err)
+		return
+	}
+
+	errorx.Ok(w, r, PresignedInfo{
+		Url:       u.String(),
+		Method:    http.MethodPut,
+		ExpiresAt: time.Now().Add(expires).Format("2006-01-02 15:04:05"),
+	})
+}
+
+// 预签名 POST 表单上传策略，可限制对象名前缀、文件大小和类型
+func PresignedPostPolicy(w http.ResponseWriter, r *http.Request) {
+	bucketname := r.FormValue("bucket_name")
+	objectname := r.FormValue("object_name")
+	if !checkPermission(w, r, bucketname, ActionWrite) {
+		return
+	}
+	prefix := r.FormValue("object_prefix")
+	contentType := r.FormValue("content_type")
+	expires, ok := presignExpiry(r)
+	if !ok || bucketname == "" || (objectname == "" && prefix == "") {
+		errorx.WriteOk(w, r, errorx.New(errorx.CodeInternalParamsError))
+		return
+	}
+
+	invalidSize := errorx.WithMsg(errorx.CodeInternalParamsError, errorx.MsgInvalidSizeRange)
+	var minSize, maxSize int64
+	var err error
+	if v := r.FormValue("min_size"); v != "" {
+		if minSize, err = strconv.ParseInt(v, 10, 64); err != nil || minSize < 0 {
+			errorx.WriteOk(w, r, invalidSize)
+			return
+		}
+	}
+	if v := r.FormValue("max_size"); v != "" {
+		if maxSize, err = strconv.ParseInt(v, 10, 64); err != nil || maxSize < 0 {
+			errorx.WriteOk(w, r, invalidSize)
+			return
+		}
+	}
+	// 服务端配置的上限优先
+	if limit := config.ConfData.Presign.MaxPostSize; limit > 0 && (maxSize <= 0 || maxSize > limit) {
+		maxSize = limit
+	}
+	if maxSize > 0 && minSize > maxSize {
+		errorx.WriteOk(w, r, invalidSize)
+		return
+	}
+
+	if isExist, _ := IsBuckets(bucketname); !isExist {
+		errorx.WriteOk(w, r, errorx.New(errorx.CodeBucketNotFound))
+		return
+	}
+
+	policy := minio.NewPostPolicy()
+	policy.SetBucket(bucketname)
+	if objectname != "" {
+		policy.SetKey(objectname)
+	} else {
+		policy.SetKeyStartsWith(prefix)
+	}
+	policy.SetExpires(time.Now().UTC().Add(expires))
+	if contentType != "" {
+		policy.SetContentType(contentType)
+	}
+	if maxSize > 0 {
+		policy.SetContentLengthRange(minSize, maxSize)
+	}
+
+	u, formData, err := store.PresignedPostPolicy(policy)
+	if err != nil {
+		errorx.WriteOk(w, r, err)
+		return
+	}
+
+	errorx.Ok(w, r, PresignedInfo{
+		Url:       u.String(),
+		Method:    http.MethodPost,
+		ExpiresAt: time.Now().Add(expires).Format("2006-01-02 15:04:05"),
+		FormData:  formData,
+	})
+}
@@ -22,6 +22,26 @@ func InitRedis() {
 		PoolTimeout:  30 * time.Second,
 	})
 	fmt.Println(config.ConfData.Redis.Address + ":" + strconv.Itoa(config.ConfData.Redis.Port))
+
+	sessionTTL := time.Duration(config.ConfData.Upload.SessionTTL) * time.Second
+	if sessionTTL <= 0 {
+		sessionTTL = 24 * time.Hour
+	}
+	mergeTimeout := time.Duration(config.ConfData.Upload.MergeTimeout) * time.Second
+	if mergeTimeout <= 0 {
+		mergeTimeout = 10 * time.Minute
+	}
+
+	switch config.ConfData.Storage.Metadata {
+	case "memory":
+		metadata = NewMemoryMetadataStore()
+		sessions = NewMemorySessionStore(sessionTTL)
+		janitors = NewMemoryJanitorStore()
+	default:
+		metadata = NewRedisMetadataStore(redisdb)
+		sessions = NewRedisSessionStore(redisdb, sessionTTL, mergeTimeout)
+		janitors = NewRedisJanitorStore(redisdb)
+	}
 }
 
 func GetClient() *redis.Client {
@@ -0,0 +1,149 @@
+package common
+
+import (
+	"encoding/json"
+	"minio_demo/errorx"
+	"net/http"
+
+	"github.com/zituocn/logx"
+)
+
+// 单次批量删除的最大文件数，与 S3 DeleteObjects 一致
+const maxRemoveObjects = 1000
+
+type RemoveResult struct {
+	Deleted []string      `json:"deleted"`
+	Errors  []RemoveError `json:"errors"`
+}
+
+type RemoveError struct {
+	ObjectName string      `json:"object_name"`
+	Code       errorx.Code `json:"code"`
+	Msg        string      `json:"msg"`
+}
+
+// 批量删除文件，读取完整的错误通道，返回删除失败的文件
+func removeObjects(bucketname string, objectnames []string) map[string]error {
+	objectsCh := make(chan string)
+	go func() {
+		defer close(objectsCh)
+		for _, name := range objectnames {
+			objectsCh <- name
+		}
+	}()
+
+	failed := make(map[string]error)
+	for v := range store.RemoveObjects(bucketname, objectsCh) {
+		if v.Err != nil {
+			logx.Errorf("remove: bucketname:%s object:%s %v", bucketname, v.ObjectName, v.Err)
+			failed[v.ObjectName] = v.Err
+		}
+	}
+	return failed
+}
+
+// 删除已删除文件的文件记录，避免秒传返回已删除的文件
+func removeMetadata(bucketname string, objectnames []string, failed map[string]error) {
+	for _, name := range objectnames {
+		if _, ok := failed[name]; ok {
+			continue
+		}
+		if err := metadata.Delete(bucketname, name); err != nil {
+			logx.Error("metadata Delete error:", err.Error())
+			failed[name] = err
+		}
+	}
+}
+
+func removeResult(r *http.Request, objectnames []string, failed map[string]error) RemoveResult {
+	lang := errorx.Lang(r)
+	result := RemoveResult{Deleted: []string{}, Errors: []RemoveError{}}
+	for _, name := range objectnames {
+		err, ok := failed[name]
+		if !ok {
+			result.Deleted = append(result.Deleted, name)
+			continue
+		}
+		e := errorx.From(err)
+		result.Errors = append(result.Errors, RemoveError{
+			ObjectName: name,
+			Code:       e.Code,
+			Msg:        e.Message(lang),
+		})
+	}
+	return result
+}
+
+// 删除文件和文件记录，versionId 非空时永久删除该版本
+func removeObject(bucketname, objectname, versionId string) error {
+	if versionId != "" {
+		return removeObjectVersion(bucketname, objectname, versionId)
+	}
+	if err := store.RemoveObject(bucketname, objectname); err != nil {
+		return err
+	}
+	return metadata.Delete(bucketname, objectname)
+}
+
+// 去重，保持请求中的顺序
+func uniqueNames(names []string) []string {
+	seen := make(map[string]bool, len(names))
+	list := make([]string, 0, len(names))
+	for _, v := range names {
+		if v == "" || seen[v] {
+			continue
+		}
+		seen[v] = true
+		list = append(list, v)
+	}
+	return list
+}
+
+// 删除文件
+func RemoveObject(w http.ResponseWriter, r *http.Request) {
+	bucketname := r.PostFormValue("bucket_name")
+	objectname := r.PostFormValue("object_name")
+	if !checkPermission(w, r, bucketname, ActionDelete) {
+		return
+	}
+	if bucketname == "" || objectname == "" {
+		errorx.WriteOk(w, r, errorx.New(errorx.CodeInternalParamsError))
+		return
+	}
+
+	if err := removeObject(bucketname, objectname, r.PostFormValue("version_id")); err != nil {
+		errorx.WriteOk(w, r, err)
+		return
+	}
+	errorx.Ok(w, r, nil)
+}
+
+// 批量删除文件，object_names 为 json 数组，也可以重复传 object_name
+func RemoveObjects(w http.ResponseWriter, r *http.Request) {
+	bucketname := r.PostFormValue("bucket_name")
+	if !checkPermission(w, r, bucketname, ActionDelete) {
+		return
+	}
+	objectnames := r.PostForm["object_name"]
+	if v := r.PostFormValue("object_names"); v != "" {
+		names := make([]string, 0)
+		if err := json.Unmarshal([]byte(v), &names); err != nil {
+			errorx.WriteOk(w, r, errorx.New(errorx.CodeInternalParamsError))
+			return
+		}
+		objectnames = append(objectnames, names...)
+	}
+	objectnames = uniqueNames(objectnames)
+	if bucketname == "" || len(objectnames) == 0 || len(objectnames) > maxRemoveObjects {
+		errorx.WriteOk(w, r, errorx.WithMsg(errorx.CodeInternalParamsError, errorx.MsgInvalidObjectNames, maxRemoveObjects))
+		return
+	}
+	if isExist, err := IsBuckets(bucketname); err != nil || !isExist {
+		errorx.WriteOk(w, r, errorx.New(errorx.CodeBucketNotFound))
+		return
+	}
+
+	failed := removeObjects(bucketname, objectnames)
+	removeMetadata(bucketname, objectnames, failed)
+	errorx.Ok(w, r, removeResult(r, objectnames, failed))
+}
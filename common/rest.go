@@ -0,0 +1,386 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"minio_demo/errorx"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/zituocn/logx"
+)
+
+// 资源风格接口前缀，旧的动词路由保留作为兼容层
+const restPrefix = "/api/v1/"
+
+// 资源风格接口
+//
+//	GET    /api/v1/buckets                          桶列表
+//	PUT    /api/v1/buckets/{bucket}                 创建桶
+//	HEAD   /api/v1/buckets/{bucket}                 桶是否存在
+//	DELETE /api/v1/buckets/{bucket}                 删除桶，?force=true&confirm={bucket} 时先清空桶
+//	GET    /api/v1/buckets/{bucket}?versioning      版本控制状态
+//	PUT    /api/v1/buckets/{bucket}?versioning      开启或暂停版本控制，&status=Enabled|Suspended
+//	GET    /api/v1/buckets/{bucket}?lifecycle       生命周期规则
+//	PUT    /api/v1/buckets/{bucket}?lifecycle       覆盖生命周期规则，请求体为 {"rules": [...]}
+//	DELETE /api/v1/buckets/{bucket}?lifecycle       删除生命周期规则，保留默认规则
+//	GET    /api/v1/buckets/{bucket}/objects         对象列表，查询条件见 parseListOptions
+//	GET    /api/v1/buckets/{bucket}/objects?versions 对象版本列表，查询条件见 listVersionPage
+//	POST   /api/v1/buckets/{bucket}/objects?delete  批量删除对象
+//	GET    /api/v1/buckets/{bucket}/objects/{key}   下载对象，?versionId= 时下载指定版本
+//	HEAD   /api/v1/buckets/{bucket}/objects/{key}   对象信息
+//	PUT    /api/v1/buckets/{bucket}/objects/{key}   上传对象，请求体为文件内容
+//	DELETE /api/v1/buckets/{bucket}/objects/{key}   删除对象，?versionId= 时永久删除指定版本
+func RestV1(w http.ResponseWriter, r *http.Request) {
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, restPrefix), "/", 4)
+	if parts[0] != "buckets" {
+		errorx.Write(w, r, errorx.New(errorx.CodeNotFound))
+		return
+	}
+	switch {
+	case len(parts) == 1 || (len(parts) == 2 && parts[1] == ""):
+		restBuckets(w, r)
+	case len(parts) == 2 || (len(parts) == 3 && parts[2] == ""):
+		restBucket(w, r, parts[1])
+	case parts[2] != "objects":
+		errorx.Write(w, r, errorx.New(errorx.CodeNotFound))
+	case len(parts) == 3 || parts[3] == "":
+		restObjects(w, r, parts[1])
+	default:
+		restObject(w, r, parts[1], parts[3])
+	}
+}
+
+func restBuckets(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, r, http.MethodGet)
+		return
+	}
+	bucket_list, err := listBuckets(r)
+	if err != nil {
+		errorx.Write(w, r, err)
+		return
+	}
+	errorx.Ok(w, r, bucket_list)
+}
+
+func restBucket(w http.ResponseWriter, r *http.Request, bucketname string) {
+	// ?versioning 为版本控制子资源，带值时是创建桶的参数
+	if v, ok := r.URL.Query()["versioning"]; ok && v[0] == "" {
+		restBucketVersioning(w, r, bucketname)
+		return
+	}
+	if _, ok := r.URL.Query()["lifecycle"]; ok {
+		restBucketLifecycle(w, r, bucketname)
+		return
+	}
+	switch r.Method {
+	case http.MethodHead:
+		if !restPermission(w, r, bucketname, ActionList) {
+			return
+		}
+		isExist, err := IsBuckets(bucketname)
+		if err != nil {
+			w.WriteHeader(errorx.From(err).Code.Status())
+			return
+		}
+		if !isExist {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	case http.MethodPut:
+		if !restPermission(w, r, bucketname, ActionAdmin) {
+			return
+		}
+		opts, err := parseBucketOptions(r)
+		if err != nil {
+			errorx.Write(w, r, err)
+			return
+		}
+		info, err := createBucket(bucketname, opts)
+		if err != nil {
+			errorx.Write(w, r, err)
+			return
+		}
+		if !info.Created {
+			errorx.WriteData(w, r, http.StatusOK, errorx.MsgBucketExists, info)
+			return
+		}
+		errorx.WriteData(w, r, http.StatusCreated, errorx.MsgBucketCreated, info)
+	case http.MethodDelete:
+		if !restPermission(w, r, bucketname, ActionAdmin) {
+			return
+		}
+		query := r.URL.Query()
+		force, _ := strconv.ParseBool(query.Get("force"))
+		result, err := removeBucket(bucketname, force, query.Get("confirm"))
+		if err != nil {
+			errorx.Write(w, r, err)
+			return
+		}
+		if result != nil {
+			errorx.Ok(w, r, result)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		methodNotAllowed(w, r, http.MethodHead, http.MethodPut, http.MethodDelete)
+	}
+}
+
+// 查询、覆盖或删除生命周期规则，PUT 的请求体为 {"rules": [...]}
+func restBucketLifecycle(w http.ResponseWriter, r *http.Request, bucketname string) {
+	switch r.Method {
+	case http.MethodGet:
+		if !restPermission(w, r, bucketname, ActionList) {
+			return
+		}
+		lifecycle, err := getBucketLifecycle(bucketname)
+		if err != nil {
+			errorx.Write(w, r, err)
+			return
+		}
+		errorx.Ok(w, r, lifecycle)
+	case http.MethodPut:
+		if !restPermission(w, r, bucketname, ActionAdmin) {
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxLifecycleBody))
+		if err != nil {
+			errorx.Write(w, r, err)
+			return
+		}
+		lifecycle, err := parseBucketLifecycle(body)
+		if err != nil {
+			errorx.Write(w, r, err)
+			return
+		}
+		if err := setBucketLifecycle(bucketname, lifecycle.Rules); err != nil {
+			errorx.Write(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		if !restPermission(w, r, bucketname, ActionAdmin) {
+			return
+		}
+		if err := deleteBucketLifecycle(bucketname); err != nil {
+			errorx.Write(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		methodNotAllowed(w, r, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+}
+
+// 查询或设置版本控制，PUT 时 status 为 Enabled 或 Suspended
+func restBucketVersioning(w http.ResponseWriter, r *http.Request, bucketname string) {
+	switch r.Method {
+	case http.MethodGet:
+		if !restPermission(w, r, bucketname, ActionList) {
+			return
+		}
+		status, err := store.GetBucketVersioning(bucketname)
+		if err != nil {
+			errorx.Write(w, r, err)
+			return
+		}
+		errorx.Ok(w, r, BucketVersioning{Status: status})
+	case http.MethodPut:
+		if !restPermission(w, r, bucketname, ActionAdmin) {
+			return
+		}
+		if err := setBucketVersioning(bucketname, r.URL.Query().Get("status")); err != nil {
+			errorx.Write(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		methodNotAllowed(w, r, http.MethodGet, http.MethodPut)
+	}
+}
+
+func restObjects(w http.ResponseWriter, r *http.Request, bucketname string) {
+	if _, ok := r.URL.Query()["delete"]; ok && r.Method == http.MethodPost {
+		restRemoveObjects(w, r, bucketname)
+		return
+	}
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, r, http.MethodGet, http.MethodPost)
+		return
+	}
+	if !restPermission(w, r, bucketname, ActionList) {
+		return
+	}
+	if _, ok := r.URL.Query()["versions"]; ok {
+		list, err := listVersionPage(bucketname, r)
+		if err != nil {
+			errorx.Write(w, r, err)
+			return
+		}
+		errorx.Ok(w, r, list)
+		return
+	}
+	opts, err := parseListOptions(r)
+	if err != nil {
+		errorx.Write(w, r, err)
+		return
+	}
+	list, err := listObjectPage(bucketname, opts)
+	if err != nil {
+		errorx.Write(w, r, err)
+		return
+	}
+	errorx.Ok(w, r, list)
+}
+
+func restObject(w http.ResponseWriter, r *http.Request, bucketname, objectname string) {
+	switch r.Method {
+	case http.MethodHead:
+		if !restPermission(w, r, bucketname, ActionRead) {
+			return
+		}
+		headObject(w, r, bucketname, objectname, r.URL.Query().Get("versionId"))
+	case http.MethodGet:
+		if !restPermission(w, r, bucketname, ActionRead) {
+			return
+		}
+		object, err := store.GetObjectVersion(bucketname, objectname, r.URL.Query().Get("versionId"))
+		if err != nil {
+			errorx.Write(w, r, err)
+			return
+		}
+		defer object.Close()
+		stat, err := object.Stat()
+		if err != nil {
+			errorx.Write(w, r, err)
+			return
+		}
+		serveObject(w, r, object, stat, objectname)
+	case http.MethodPut:
+		if !restPermission(w, r, bucketname, ActionWrite) {
+			return
+		}
+		restPutObject(w, r, bucketname, objectname)
+	case http.MethodDelete:
+		if !restPermission(w, r, bucketname, ActionDelete) {
+			return
+		}
+		if err := removeObject(bucketname, objectname, r.URL.Query().Get("versionId")); err != nil {
+			errorx.Write(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		methodNotAllowed(w, r, http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete)
+	}
+}
+
+// 批量删除，请求体为 {"objects": ["key1", "key2"]}
+func restRemoveObjects(w http.ResponseWriter, r *http.Request, bucketname string) {
+	if !restPermission(w, r, bucketname, ActionDelete) {
+		return
+	}
+	var body struct {
+		Objects []string `json:"objects"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		errorx.Write(w, r, errorx.New(errorx.CodeInternalParamsError))
+		return
+	}
+	objectnames := uniqueNames(body.Objects)
+	if len(objectnames) == 0 || len(objectnames) > maxRemoveObjects {
+		errorx.Write(w, r, errorx.WithMsg(errorx.CodeInternalParamsError, errorx.MsgInvalidObjectNames, maxRemoveObjects))
+		return
+	}
+	if isExist, err := IsBuckets(bucketname); err != nil || !isExist {
+		errorx.Write(w, r, errorx.New(errorx.CodeBucketNotFound))
+		return
+	}
+
+	failed := removeObjects(bucketname, objectnames)
+	removeMetadata(bucketname, objectnames, failed)
+	errorx.Ok(w, r, removeResult(r, objectnames, failed))
+}
+
+// 请求体即文件内容，校验值只从请求头读取
+func restPutObject(w http.ResponseWriter, r *http.Request, bucketname, objectname string) {
+	if r.ContentLength < 0 {
+		errorx.Write(w, r, errorx.WithMsg(errorx.CodeInternalParamsError, errorx.MsgContentLengthRequired))
+		return
+	}
+	if isExist, err := IsBuckets(bucketname); err != nil || !isExist {
+		errorx.Write(w, r, errorx.New(errorx.CodeBucketNotFound))
+		return
+	}
+	if err := checkQuota(bucketname, r.ContentLength); err != nil {
+		errorx.Write(w, r, err)
+		return
+	}
+
+	meta, err := parseObjectMetaHeader(r)
+	if err != nil {
+		errorx.Write(w, r, err)
+		return
+	}
+	meta.ContentType = r.Header.Get("Content-Type")
+	// 请求体不能回退，识别类型时读取的内容重新拼接到请求体前面
+	var reader io.Reader = r.Body
+	contentType := meta.detectContentType(objectname, "", func() []byte {
+		head := make([]byte, 512)
+		n, _ := io.ReadFull(r.Body, head)
+		reader = io.MultiReader(bytes.NewReader(head[:n]), r.Body)
+		return head[:n]
+	})
+	var sysMeta map[string]string
+	checksum := parseChecksumHeader(r)
+	if checksum != nil {
+		sysMeta = checksum.userMetadata()
+	}
+	// 校验失败时不写入，同名文件保持不变
+	_, err = putObjectChecked(bucketname, objectname, reader, r.ContentLength, meta.putOptions(contentType, sysMeta), checksum)
+	if err == ErrChecksumMismatch {
+		logx.Errorf("put object %s %s mismatch", objectname, checksum.Algorithm)
+		errorx.Write(w, r, errorx.New(errorx.CodeChecksumMismatch))
+		return
+	}
+	if err != nil {
+		errorx.Write(w, r, err)
+		return
+	}
+	if err := putObjectTags(bucketname, objectname, meta.Tags); err != nil {
+		errorx.Write(w, r, err)
+		return
+	}
+
+	info, err := GetStatObject(bucketname, objectname)
+	if err != nil {
+		errorx.Write(w, r, err)
+		return
+	}
+	info.Tags = meta.Tags
+	if err := metadata.Save("", info); err != nil {
+		logx.Error("metadata Save error:", err.Error())
+	}
+	w.Header().Set("ETag", `"`+info.Md5+`"`)
+	errorx.WriteData(w, r, http.StatusCreated, errorx.MsgSuccess, info)
+}
+
+func methodNotAllowed(w http.ResponseWriter, r *http.Request, methods ...string) {
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	errorx.Write(w, r, errorx.New(errorx.CodeMethodNotAllowed))
+}
+
+// 检查权限，没有权限时返回 403
+func restPermission(w http.ResponseWriter, r *http.Request, bucketname, action string) bool {
+	if authorize(r, bucketname, action) {
+		return true
+	}
+	logx.Notice("permission denied: bucket:" + bucketname + " action:" + action)
+	errorx.Write(w, r, errorx.New(errorx.CodeForbidden))
+	return false
+}
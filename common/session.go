@@ -0,0 +1,124 @@
+package common
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+)
+
+var ErrSessionNotFound = errors.New("upload session not found")
+
+const (
+	SessionUploading = "uploading"
+	SessionMerging   = "merging"
+	SessionFinished  = "finished"
+	SessionFailed    = "failed"
+)
+
+// 分片上传会话
+type UploadSession struct {
+	Identifier  string `json:"identifier"`
+	BucketName  string `json:"bucket_name"`
+	Filename    string `json:"filename"`
+	ChunkSize   int64  `json:"chunk_size"`
+	TotalChunks int    `json:"total_chunks"`
+	TotalSize   int64  `json:"total_size"`
+	State       string `json:"state"`
+	CreatedAt   int64  `json:"created_at"`
+	UpdatedAt   int64  `json:"updated_at"`
+	// 创建会话时指定的对象属性，合并时写入
+	Meta *ObjectMeta `json:"meta,omitempty"`
+	// 已接收的分片编号
+	Chunks []int `json:"chunks"`
+	// 已接收分片的md5，上传时计算，key 为分片编号
+	ChunkMd5 map[int]string `json:"chunk_md5,omitempty"`
+	// 按顺序接收的分片计算的文件摘要，合并时只需读取未计入的分片
+	Digest *FileDigest `json:"digest,omitempty"`
+	// S3 分段上传的 ID，分段上传会话的分片即分段
+	UploadId string `json:"upload_id,omitempty"`
+}
+
+// 会话 key，同时也是分片对象的前缀
+func (s *UploadSession) Key() string {
+	if s.UploadId != "" {
+		return multipartSessionKey(s.UploadId)
+	}
+	return sessionKey(s.Identifier, s.ChunkSize)
+}
+
+func multipartSessionKey(uploadId string) string {
+	return "multipart:" + uploadId
+}
+
+func sessionKey(identifier string, chunkSize int64) string {
+	return identifier + "_" + strconv.FormatInt(chunkSize, 10)
+}
+
+// 分片上传会话存储，多个实例共享同一份会话状态
+type SessionStore interface {
+	// 查询会话，包含已接收的分片
+	Get(key string) (*UploadSession, error)
+	// 会话不存在时创建，已存在时返回已有会话
+	Create(session *UploadSession) (*UploadSession, error)
+	SetState(key, state string) error
+	// 标记分片已接收，md5 为分片内容的md5，未知时为空
+	// digest 非 nil 时为计入该分片后的文件摘要，只在会话摘要恰好计入到前一个分片时更新；
+	// 已计入摘要的分片内容改变时丢弃会话摘要
+	AddChunk(key string, chunkNumber int, md5 string, digest *FileDigest) error
+	RemoveChunk(key string, chunkNumber int) error
+	// 获取合并锁，同一会话同一时间只允许一个实例合并
+	// 返回锁的 token，锁已被持有时返回空，释放时只删除 token 相同的锁
+	AcquireMerge(key string) (string, error)
+	ReleaseMerge(key, token string) error
+	Delete(key string) error
+	List() ([]*UploadSession, error)
+}
+
+var sessions SessionStore
+
+// 注入分片上传会话存储实现
+func SetSessionStore(s SessionStore) {
+	sessions = s
+}
+
+// 随机 token，用于标识锁的持有者
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func now() int64 {
+	return time.Now().Unix()
+}
+
+// 记录分片md5并推进文件摘要，调用方需持有会话的锁或事务
+func (s *UploadSession) addChunk(chunkNumber int, md5 string, digest *FileDigest) {
+	if md5 != "" {
+		if s.ChunkMd5 == nil {
+			s.ChunkMd5 = make(map[int]string)
+		}
+		if old, ok := s.ChunkMd5[chunkNumber]; ok && old != md5 && s.Digest != nil && s.Digest.Chunks >= chunkNumber {
+			s.Digest = nil
+		}
+		s.ChunkMd5[chunkNumber] = md5
+	}
+	if digest != nil && digest.Chunks == s.Digest.next() {
+		s.Digest = digest
+	}
+	s.UpdatedAt = now()
+}
+
+func sortedChunks(set map[int]bool) []int {
+	chunks := make([]int, 0, len(set))
+	for k := range set {
+		chunks = append(chunks, k)
+	}
+	sort.Ints(chunks)
+	return chunks
+}
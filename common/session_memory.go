@@ -0,0 +1,150 @@
+package common
+
+import (
+	"sync"
+	"time"
+)
+
+// 进程内存实现，仅适用于单实例部署
+type memorySessionStore struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	sessions map[string]*memorySession
+}
+
+type memorySession struct {
+	session UploadSession
+	chunks  map[int]bool
+	// 合并锁 token，为空时未加锁
+	merging string
+}
+
+func NewMemorySessionStore(ttl time.Duration) SessionStore {
+	return &memorySessionStore{ttl: ttl, sessions: make(map[string]*memorySession)}
+}
+
+// 调用方需持有锁
+func (s *memorySessionStore) get(key string) (*memorySession, bool) {
+	v, ok := s.sessions[key]
+	if ok && s.ttl > 0 && time.Since(time.Unix(v.session.UpdatedAt, 0)) > s.ttl {
+		delete(s.sessions, key)
+		return nil, false
+	}
+	return v, ok
+}
+
+func (s *memorySessionStore) copy(v *memorySession) *UploadSession {
+	session := v.session
+	session.Chunks = sortedChunks(v.chunks)
+	if v.session.ChunkMd5 != nil {
+		session.ChunkMd5 = make(map[int]string, len(v.session.ChunkMd5))
+		for k, md5 := range v.session.ChunkMd5 {
+			session.ChunkMd5[k] = md5
+		}
+	}
+	return &session
+}
+
+func (s *memorySessionStore) Get(key string) (*UploadSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.get(key)
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	return s.copy(v), nil
+}
+
+func (s *memorySessionStore) Create(session *UploadSession) (*UploadSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if v, ok := s.get(session.Key()); ok {
+		return s.copy(v), nil
+	}
+	v := &memorySession{session: *session, chunks: make(map[int]bool)}
+	v.session.State = SessionUploading
+	v.session.CreatedAt = now()
+	v.session.UpdatedAt = v.session.CreatedAt
+	v.session.Chunks = nil
+	s.sessions[session.Key()] = v
+	return s.copy(v), nil
+}
+
+func (s *memorySessionStore) SetState(key, state string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.get(key)
+	if !ok {
+		return ErrSessionNotFound
+	}
+	v.session.State = state
+	v.session.UpdatedAt = now()
+	return nil
+}
+
+func (s *memorySessionStore) AddChunk(key string, chunkNumber int, md5 string, digest *FileDigest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.get(key)
+	if !ok {
+		return ErrSessionNotFound
+	}
+	v.chunks[chunkNumber] = true
+	v.session.addChunk(chunkNumber, md5, digest)
+	return nil
+}
+
+func (s *memorySessionStore) RemoveChunk(key string, chunkNumber int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if v, ok := s.get(key); ok {
+		delete(v.chunks, chunkNumber)
+	}
+	return nil
+}
+
+func (s *memorySessionStore) AcquireMerge(key string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.get(key)
+	if !ok {
+		return "", ErrSessionNotFound
+	}
+	if v.merging != "" {
+		return "", nil
+	}
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	v.merging = token
+	return token, nil
+}
+
+func (s *memorySessionStore) ReleaseMerge(key, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if v, ok := s.get(key); ok && v.merging == token {
+		v.merging = ""
+	}
+	return nil
+}
+
+func (s *memorySessionStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, key)
+	return nil
+}
+
+func (s *memorySessionStore) List() ([]*UploadSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]*UploadSession, 0, len(s.sessions))
+	for key := range s.sessions {
+		if v, ok := s.get(key); ok {
+			list = append(list, s.copy(v))
+		}
+	}
+	return list, nil
+}
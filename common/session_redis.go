@@ -0,0 +1,205 @@
+package common
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// Redis 实现
+// key 规划：
+//
+//	upload:sessions              set     所有会话 key，用于遍历
+//	upload:session:<key>         string  会话信息(json，不含分片)
+//	upload:session:<key>:chunks  set     已接收的分片编号
+//	upload:session:<key>:merge   string  合并锁
+type redisSessionStore struct {
+	db       *redis.Client
+	ttl      time.Duration
+	mergeTTL time.Duration
+}
+
+func NewRedisSessionStore(db *redis.Client, ttl, mergeTTL time.Duration) SessionStore {
+	return &redisSessionStore{db: db, ttl: ttl, mergeTTL: mergeTTL}
+}
+
+const redisSessionIndex = "upload:sessions"
+
+// 会话被并发修改时的最大重试次数
+const maxSessionRetries = 10
+
+// 只删除自己持有的锁，锁过期后被其他实例获取时不删除
+var redisReleaseScript = redis.NewScript(`
+if redis.call("get", KEYS[1]) == ARGV[1] then
+	return redis.call("del", KEYS[1])
+end
+return 0`)
+
+func (s *redisSessionStore) infoKey(key string) string {
+	return "upload:session:" + key
+}
+
+func (s *redisSessionStore) chunksKey(key string) string {
+	return "upload:session:" + key + ":chunks"
+}
+
+func (s *redisSessionStore) mergeKey(key string) string {
+	return "upload:session:" + key + ":merge"
+}
+
+func (s *redisSessionStore) getInfo(key string) (*UploadSession, error) {
+	data, err := s.db.Get(s.infoKey(key)).Bytes()
+	if err == redis.Nil {
+		return nil, ErrSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	session := &UploadSession{}
+	if err := json.Unmarshal(data, session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (s *redisSessionStore) Get(key string) (*UploadSession, error) {
+	session, err := s.getInfo(key)
+	if err != nil {
+		return nil, err
+	}
+	members, err := s.db.SMembers(s.chunksKey(key)).Result()
+	if err != nil {
+		return nil, err
+	}
+	set := make(map[int]bool, len(members))
+	for _, v := range members {
+		if n, err := strconv.Atoi(v); err == nil {
+			set[n] = true
+		}
+	}
+	session.Chunks = sortedChunks(set)
+	return session, nil
+}
+
+func (s *redisSessionStore) Create(session *UploadSession) (*UploadSession, error) {
+	session.State = SessionUploading
+	session.CreatedAt = now()
+	session.UpdatedAt = session.CreatedAt
+	session.Chunks = nil
+	data, err := json.Marshal(session)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.db.SetNX(s.infoKey(session.Key()), data, s.ttl).Result(); err != nil {
+		return nil, err
+	}
+	if err := s.db.SAdd(redisSessionIndex, session.Key()).Err(); err != nil {
+		return nil, err
+	}
+	return s.Get(session.Key())
+}
+
+// 乐观锁更新会话信息，会话在读取后被其他实例修改时重试，避免覆盖其他实例的修改
+func (s *redisSessionStore) update(key string, fn func(session *UploadSession), extra func(pipe redis.Pipeliner)) error {
+	for retry := 0; retry < maxSessionRetries; retry++ {
+		err := s.db.Watch(func(tx *redis.Tx) error {
+			data, err := tx.Get(s.infoKey(key)).Bytes()
+			if err == redis.Nil {
+				return ErrSessionNotFound
+			}
+			if err != nil {
+				return err
+			}
+			session := &UploadSession{}
+			if err := json.Unmarshal(data, session); err != nil {
+				return err
+			}
+			fn(session)
+			session.Chunks = nil
+			data, err = json.Marshal(session)
+			if err != nil {
+				return err
+			}
+			_, err = tx.TxPipelined(func(pipe redis.Pipeliner) error {
+				pipe.Set(s.infoKey(key), data, s.ttl)
+				if extra != nil {
+					extra(pipe)
+				}
+				return nil
+			})
+			return err
+		}, s.infoKey(key))
+		if err != redis.TxFailedErr {
+			return err
+		}
+	}
+	return redis.TxFailedErr
+}
+
+func (s *redisSessionStore) SetState(key, state string) error {
+	return s.update(key, func(session *UploadSession) {
+		session.State = state
+		session.UpdatedAt = now()
+	}, nil)
+}
+
+func (s *redisSessionStore) AddChunk(key string, chunkNumber int, md5 string, digest *FileDigest) error {
+	// 刷新会话过期时间
+	return s.update(key, func(session *UploadSession) {
+		session.addChunk(chunkNumber, md5, digest)
+	}, func(pipe redis.Pipeliner) {
+		pipe.SAdd(s.chunksKey(key), chunkNumber)
+		pipe.Expire(s.chunksKey(key), s.ttl)
+	})
+}
+
+func (s *redisSessionStore) RemoveChunk(key string, chunkNumber int) error {
+	return s.db.SRem(s.chunksKey(key), chunkNumber).Err()
+}
+
+func (s *redisSessionStore) AcquireMerge(key string) (string, error) {
+	token, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	ok, err := s.db.SetNX(s.mergeKey(key), token, s.mergeTTL).Result()
+	if err != nil || !ok {
+		return "", err
+	}
+	return token, nil
+}
+
+func (s *redisSessionStore) ReleaseMerge(key, token string) error {
+	return redisReleaseScript.Run(s.db, []string{s.mergeKey(key)}, token).Err()
+}
+
+func (s *redisSessionStore) Delete(key string) error {
+	pipe := s.db.TxPipeline()
+	pipe.Del(s.infoKey(key), s.chunksKey(key), s.mergeKey(key))
+	pipe.SRem(redisSessionIndex, key)
+	_, err := pipe.Exec()
+	return err
+}
+
+func (s *redisSessionStore) List() ([]*UploadSession, error) {
+	keys, err := s.db.SMembers(redisSessionIndex).Result()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*UploadSession, 0, len(keys))
+	for _, key := range keys {
+		session, err := s.Get(key)
+		if err == ErrSessionNotFound {
+			// 会话已过期，清理索引
+			s.db.SRem(redisSessionIndex, key)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, session)
+	}
+	return list, nil
+}
@@ -0,0 +1,114 @@
+package common
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/minio/minio-go"
+	"github.com/zituocn/logx"
+)
+
+// 对象版本和对象锁定相关的响应头
+const (
+	headerVersionId       = "X-Amz-Version-Id"
+	headerStorageClass    = "X-Amz-Storage-Class"
+	headerTaggingCount    = "X-Amz-Tagging-Count"
+	headerLockMode        = "X-Amz-Object-Lock-Mode"
+	headerLockRetainUntil = "X-Amz-Object-Lock-Retain-Until-Date"
+	headerLockLegalHold   = "X-Amz-Object-Lock-Legal-Hold"
+)
+
+// 查询对象的完整信息，包括自定义元数据、标签、版本和对象锁定状态
+// versionId 为空时查询最新版本
+func statObjectInfo(bucketname, objectname, versionId string) (*ObjectInfo, error) {
+	stat, err := store.StatObjectVersion(bucketname, objectname, versionId)
+	if err != nil {
+		logx.Errorf("StatObject error: %v", err)
+		return nil, err
+	}
+	info := newObjectInfo(bucketname, stat)
+	// 标签不在 HEAD 响应中，只有响应头表明存在标签或存储端不返回数量时才查询
+	// 标签接口只支持最新版本
+	if count := stat.Metadata.Get(headerTaggingCount); count != "0" && versionId == "" {
+		tags, err := store.GetObjectTagging(bucketname, objectname)
+		if err != nil {
+			logx.Errorf("GetObjectTagging %s/%s %v", bucketname, objectname, err)
+		} else {
+			info.Tags = tags
+		}
+	}
+	return info, nil
+}
+
+func newObjectInfo(bucketname string, stat minio.ObjectInfo) *ObjectInfo {
+	info := &ObjectInfo{
+		ETag:         removeBackslashAndQuotes(stat.ETag),
+		BucketName:   bucketname,
+		Key:          stat.Key,
+		LastModified: stat.LastModified.Format("2006-01-02 15:04:05"),
+		Size:         stat.Size,
+		ContentType:  stat.ContentType,
+		Metadata:     stat.Metadata,
+		UserMetadata: userMetadata(stat.Metadata),
+		Tags:         map[string]string{},
+		StorageClass: stat.StorageClass,
+		VersionID:    stat.Metadata.Get(headerVersionId),
+		LegalHold:    stat.Metadata.Get(headerLockLegalHold),
+	}
+	info.Owner = stat.Owner
+	if info.StorageClass == "" {
+		info.StorageClass = stat.Metadata.Get(headerStorageClass)
+	}
+	if mode := stat.Metadata.Get(headerLockMode); mode != "" {
+		info.Retention = &ObjectRetention{
+			Mode:            mode,
+			RetainUntilDate: stat.Metadata.Get(headerLockRetainUntil),
+		}
+	}
+	return info
+}
+
+// HEAD 请求只返回响应头，不读取对象内容
+func headObject(w http.ResponseWriter, r *http.Request, bucketname, objectname, versionId string) {
+	stat, err := store.StatObjectVersion(bucketname, objectname, versionId)
+	if err != nil {
+		logx.Errorf("StatObject error: %v", err)
+		status := minio.ToErrorResponse(err).StatusCode
+		if status == 0 {
+			status = http.StatusInternalServerError
+		}
+		w.WriteHeader(status)
+		return
+	}
+	header := w.Header()
+	contentType := stat.ContentType
+	if contentType == "" {
+		contentType = defaultContentType
+	}
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Length", strconv.FormatInt(stat.Size, 10))
+	header.Set("Last-Modified", stat.LastModified.UTC().Format(http.TimeFormat))
+	header.Set("Accept-Ranges", "bytes")
+	etag := removeBackslashAndQuotes(stat.ETag)
+	if etag != "" {
+		header.Set("ETag", `"`+etag+`"`)
+	}
+	for k, v := range userMetadata(stat.Metadata) {
+		header.Set("X-Amz-Meta-"+k, v)
+	}
+	for _, k := range []string{headerVersionId, headerTaggingCount, headerLockMode, headerLockRetainUntil, headerLockLegalHold} {
+		if v := stat.Metadata.Get(k); v != "" {
+			header.Set(k, v)
+		}
+	}
+	if stat.StorageClass != "" {
+		header.Set(headerStorageClass, stat.StorageClass)
+	}
+
+	if match := r.Header.Get("If-None-Match"); etag != "" && removeBackslashAndQuotes(match) == etag {
+		header.Del("Content-Length")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
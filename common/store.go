@@ -0,0 +1,146 @@
+package common
+
+import (
+	"io"
+	"net/url"
+	"time"
+
+	"github.com/minio/minio-go"
+)
+
+// 对象存储后端，handler 只依赖该接口，不直接使用 minio.Client
+type ObjectStore interface {
+	MakeBucket(bucketname, location string) error
+	RemoveBucket(bucketname string) error
+	BucketExists(bucketname string) (bool, error)
+	ListBuckets() ([]minio.BucketInfo, error)
+	// policy 为 S3 桶策略 json，为空时删除策略
+	SetBucketPolicy(bucketname, policy string) error
+	SetBucketVersioning(bucketname string, enabled bool) error
+	// 返回 Enabled、Suspended，从未开启过版本控制时为空
+	GetBucketVersioning(bucketname string) (string, error)
+	SetBucketTagging(bucketname string, tags map[string]string) error
+	// lifecycle 为 S3 生命周期配置 xml，为空时删除配置；未配置时返回空
+	GetBucketLifecycle(bucketname string) (string, error)
+	SetBucketLifecycle(bucketname, lifecycle string) error
+
+	// opts.UserMetadata 中的 X-Amz-Tagging 作为对象标签写入，格式为 url 编码的 k1=v1&k2=v2
+	PutObject(bucketname, objectname string, reader io.Reader, size int64, opts minio.PutObjectOptions) (int64, error)
+	// 单次 PUT 写入并由存储端按 Content-MD5 校验，不一致时不写入并返回 BadDigest
+	// size 不能超过 maxSinglePutSize
+	PutObjectMd5(bucketname, objectname string, reader io.Reader, size int64, md5Base64 string, opts minio.PutObjectOptions) (int64, error)
+	GetObject(bucketname, objectname string, opts minio.GetObjectOptions) (StoreObject, error)
+	StatObject(bucketname, objectname string, opts minio.StatObjectOptions) (minio.ObjectInfo, error)
+	ListObjects(bucketname, prefix string, recursive bool, doneCh <-chan struct{}) <-chan minio.ObjectInfo
+	// 分页查询，delimiter 非空时同一层级下的对象合并为 CommonPrefixes
+	ListObjectsV2(bucketname, prefix, continuationToken, delimiter string, maxKeys int) (minio.ListBucketV2Result, error)
+	RemoveObject(bucketname, objectname string) error
+	// tags 为空时删除对象标签，覆盖写入对象时标签会被清除
+	SetObjectTagging(bucketname, objectname string, tags map[string]string) error
+	GetObjectTagging(bucketname, objectname string) (map[string]string, error)
+	RemoveObjects(bucketname string, objectsCh <-chan string) <-chan minio.RemoveObjectError
+	// 将同一个桶内的多个对象按顺序合并为 objectname
+	ComposeObject(bucketname, objectname string, srcs []SrcInfo, userMeta map[string]string) error
+	// 服务端复制对象，可跨桶，userMeta 为 nil 时保留源对象的元数据，否则替换
+	CopyObject(bucketname, objectname string, src CopySrc, userMeta map[string]string) error
+
+	// 版本控制，versionId 为空时操作最新版本
+	ListObjectVersions(bucketname, prefix, keyMarker, versionIdMarker string, maxKeys int) (ListVersionsResult, error)
+	StatObjectVersion(bucketname, objectname, versionId string) (minio.ObjectInfo, error)
+	GetObjectVersion(bucketname, objectname, versionId string) (StoreObject, error)
+	// 永久删除指定版本，删除最新版本后上一个版本成为最新版本
+	RemoveObjectVersion(bucketname, objectname, versionId string) error
+	// 批量永久删除版本，一次最多 maxRemoveVersions 个，返回删除失败的版本
+	RemoveObjectVersions(bucketname string, versions []ObjectVersion) ([]ObjectVersion, error)
+
+	// S3 分段上传，分段在完成前不会作为对象出现在桶内
+	NewMultipartUpload(bucketname, objectname string, opts minio.PutObjectOptions) (string, error)
+	PutObjectPart(bucketname, objectname, uploadID string, partNumber int, reader io.Reader, size int64) (minio.ObjectPart, error)
+	ListObjectParts(bucketname, objectname, uploadID string) ([]minio.ObjectPart, error)
+	CompleteMultipartUpload(bucketname, objectname, uploadID string, parts []minio.CompletePart) (string, error)
+	AbortMultipartUpload(bucketname, objectname, uploadID string) error
+	ListIncompleteUploads(bucketname, prefix string, recursive bool, doneCh <-chan struct{}) <-chan minio.ObjectMultipartInfo
+
+	// 预签名地址，客户端可直接访问存储端
+	PresignedGetObject(bucketname, objectname string, expires time.Duration, reqParams url.Values) (*url.URL, error)
+	PresignedPutObject(bucketname, objectname string, expires time.Duration) (*url.URL, error)
+	PresignedPostPolicy(policy *minio.PostPolicy) (*url.URL, map[string]string, error)
+}
+
+// 复制源对象，Etag 非空时源对象被修改则复制失败
+type CopySrc struct {
+	BucketName string
+	Name       string
+	Etag       string
+	Size       int64
+}
+
+// 版本控制状态
+const (
+	VersioningEnabled   = "Enabled"
+	VersioningSuspended = "Suspended"
+)
+
+// 对象版本，按 key 升序、同一 key 内从新到旧排列
+type ObjectVersion struct {
+	Key            string
+	VersionId      string
+	IsLatest       bool
+	IsDeleteMarker bool
+	LastModified   time.Time
+	Size           int64
+	ETag           string
+}
+
+type ListVersionsResult struct {
+	Versions            []ObjectVersion
+	IsTruncated         bool
+	NextKeyMarker       string
+	NextVersionIdMarker string
+}
+
+// 读取中的对象，*minio.Object 满足该接口
+type StoreObject interface {
+	io.ReadSeeker
+	io.ReaderAt
+	io.Closer
+	Stat() (minio.ObjectInfo, error)
+}
+
+// S3 批量删除一次最多 1000 个对象
+const maxRemoveVersions = 1000
+
+// 写入对象时设置标签的请求头
+const headerTagging = "X-Amz-Tagging"
+
+func encodeTagging(tags map[string]string) string {
+	values := make(url.Values, len(tags))
+	for k, v := range tags {
+		values.Set(k, v)
+	}
+	return values.Encode()
+}
+
+func decodeTagging(v string) (map[string]string, error) {
+	values, err := url.ParseQuery(v)
+	if err != nil {
+		return nil, err
+	}
+	tags := make(map[string]string, len(values))
+	for k := range values {
+		tags[k] = values.Get(k)
+	}
+	return tags, nil
+}
+
+var store ObjectStore
+
+// 注入对象存储实现，便于替换后端或在没有 MinIO 的环境下测试
+func SetObjectStore(s ObjectStore) {
+	store = newUsageStore(s)
+}
+
+// 获取当前对象存储实现
+func GetObjectStore() ObjectStore {
+	return store
+}
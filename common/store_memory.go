@@ -0,0 +1,926 @@
+package common
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go"
+)
+
+// 进程内存实现，仅用于本地开发和单元测试
+type memoryStore struct {
+	mu      sync.RWMutex
+	buckets map[string]*memoryBucket
+	uploads map[string]*memoryUpload
+}
+
+type memoryBucket struct {
+	created time.Time
+	objects map[string]*memoryObject
+	policy  string
+	tags    map[string]string
+	// 只保存配置，不执行过期
+	lifecycle string
+	// 版本控制状态，开启后 versions 记录每个 key 的全部版本(从旧到新)，objects 为最新版本
+	versioning string
+	versions   map[string][]*memoryObject
+}
+
+type memoryObject struct {
+	data []byte
+	info minio.ObjectInfo
+	tags map[string]string
+	// 未开启版本控制时为空，暂停版本控制时写入的版本为 null
+	versionId    string
+	deleteMarker bool
+}
+
+// 暂停版本控制时写入的版本号
+const nullVersionId = "null"
+
+type memoryUpload struct {
+	bucketname string
+	objectname string
+	opts       minio.PutObjectOptions
+	parts      map[int]*memoryObject
+	initiated  time.Time
+}
+
+// S3 要求除最后一个分段外，每个分段不小于 5MiB
+const minPartSize = 5 * 1024 * 1024
+
+func NewMemoryStore() ObjectStore {
+	return &memoryStore{
+		buckets: make(map[string]*memoryBucket),
+		uploads: make(map[string]*memoryUpload),
+	}
+}
+
+func memoryError(code, msg, bucketname, objectname string, status int) error {
+	return minio.ErrorResponse{
+		Code:       code,
+		Message:    msg,
+		BucketName: bucketname,
+		Key:        objectname,
+		StatusCode: status,
+	}
+}
+
+func errNoSuchBucket(bucketname string) error {
+	return memoryError("NoSuchBucket", "The specified bucket does not exist", bucketname, "", http.StatusNotFound)
+}
+
+func errNoSuchKey(bucketname, objectname string) error {
+	return memoryError("NoSuchKey", "The specified key does not exist.", bucketname, objectname, http.StatusNotFound)
+}
+
+func (s *memoryStore) MakeBucket(bucketname, location string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.buckets[bucketname]; ok {
+		return memoryError("BucketAlreadyOwnedByYou", "Your previous request to create the named bucket succeeded and you already own it.", bucketname, "", http.StatusConflict)
+	}
+	s.buckets[bucketname] = &memoryBucket{
+		created:  time.Now(),
+		objects:  make(map[string]*memoryObject),
+		versions: make(map[string][]*memoryObject),
+	}
+	return nil
+}
+
+func (s *memoryStore) SetBucketPolicy(bucketname, policy string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	bucket, ok := s.buckets[bucketname]
+	if !ok {
+		return errNoSuchBucket(bucketname)
+	}
+	bucket.policy = policy
+	return nil
+}
+
+func (s *memoryStore) SetBucketVersioning(bucketname string, enabled bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	bucket, ok := s.buckets[bucketname]
+	if !ok {
+		return errNoSuchBucket(bucketname)
+	}
+	// 开启前已存在的对象成为 null 版本
+	if bucket.versioning == "" {
+		for name, object := range bucket.objects {
+			object.versionId = nullVersionId
+			object.info.Metadata.Set(headerVersionId, nullVersionId)
+			bucket.versions[name] = []*memoryObject{object}
+		}
+	}
+	bucket.versioning = VersioningSuspended
+	if enabled {
+		bucket.versioning = VersioningEnabled
+	}
+	return nil
+}
+
+func (s *memoryStore) GetBucketVersioning(bucketname string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	bucket, ok := s.buckets[bucketname]
+	if !ok {
+		return "", errNoSuchBucket(bucketname)
+	}
+	return bucket.versioning, nil
+}
+
+func (s *memoryStore) SetBucketTagging(bucketname string, tags map[string]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	bucket, ok := s.buckets[bucketname]
+	if !ok {
+		return errNoSuchBucket(bucketname)
+	}
+	bucket.tags = make(map[string]string, len(tags))
+	for k, v := range tags {
+		bucket.tags[k] = v
+	}
+	return nil
+}
+
+func (s *memoryStore) GetBucketLifecycle(bucketname string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	bucket, ok := s.buckets[bucketname]
+	if !ok {
+		return "", errNoSuchBucket(bucketname)
+	}
+	return bucket.lifecycle, nil
+}
+
+func (s *memoryStore) SetBucketLifecycle(bucketname, lifecycle string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	bucket, ok := s.buckets[bucketname]
+	if !ok {
+		return errNoSuchBucket(bucketname)
+	}
+	bucket.lifecycle = lifecycle
+	return nil
+}
+
+func (s *memoryStore) RemoveBucket(bucketname string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	bucket, ok := s.buckets[bucketname]
+	if !ok {
+		return errNoSuchBucket(bucketname)
+	}
+	if len(bucket.objects) > 0 || len(bucket.versions) > 0 {
+		return memoryError("BucketNotEmpty", "The bucket you tried to delete is not empty", bucketname, "", http.StatusConflict)
+	}
+	delete(s.buckets, bucketname)
+	return nil
+}
+
+func (s *memoryStore) BucketExists(bucketname string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.buckets[bucketname]
+	return ok, nil
+}
+
+func (s *memoryStore) ListBuckets() ([]minio.BucketInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make([]minio.BucketInfo, 0, len(s.buckets))
+	for name, bucket := range s.buckets {
+		list = append(list, minio.BucketInfo{Name: name, CreationDate: bucket.created})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+func (s *memoryStore) PutObject(bucketname, objectname string, reader io.Reader, size int64, opts minio.PutObjectOptions) (int64, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return 0, err
+	}
+	if size >= 0 && int64(len(data)) != size {
+		return 0, memoryError("IncompleteBody", "You did not provide the number of bytes specified by the Content-Length HTTP header.", bucketname, objectname, http.StatusBadRequest)
+	}
+
+	header := make(http.Header)
+	var tags map[string]string
+	for k, v := range opts.UserMetadata {
+		if strings.EqualFold(k, headerTagging) {
+			if tags, err = decodeTagging(v); err != nil {
+				return 0, memoryError("InvalidArgument", "The header 'x-amz-tagging' shall be encoded as UTF-8 then URLEncoded URL query parameters without tag name duplicates.", bucketname, objectname, http.StatusBadRequest)
+			}
+			continue
+		}
+		if strings.HasPrefix(strings.ToLower(k), "x-amz-") {
+			header.Set(k, v)
+		} else {
+			header.Set("X-Amz-Meta-"+k, v)
+		}
+	}
+	contentType := opts.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	header.Set("Content-Type", contentType)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	bucket, ok := s.buckets[bucketname]
+	if !ok {
+		return 0, errNoSuchBucket(bucketname)
+	}
+	sum := md5.Sum(data)
+	object := &memoryObject{
+		data: data,
+		info: minio.ObjectInfo{
+			ETag:         hex.EncodeToString(sum[:]),
+			Key:          objectname,
+			LastModified: time.Now().UTC(),
+			Size:         int64(len(data)),
+			ContentType:  contentType,
+			Metadata:     header,
+			StorageClass: opts.StorageClass,
+		},
+		tags: tags,
+	}
+	bucket.addVersion(objectname, object)
+	bucket.objects[objectname] = object
+	return int64(len(data)), nil
+}
+
+// 按版本控制状态记录新版本，暂停时替换已有的 null 版本
+func (s *memoryStore) PutObjectMd5(bucketname, objectname string, reader io.Reader, size int64, md5Base64 string, opts minio.PutObjectOptions) (int64, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return 0, err
+	}
+	sum := md5.Sum(data)
+	if base64.StdEncoding.EncodeToString(sum[:]) != md5Base64 {
+		return 0, memoryError("BadDigest", "The Content-Md5 you specified did not match what we received.", bucketname, objectname, http.StatusBadRequest)
+	}
+	return s.PutObject(bucketname, objectname, bytes.NewReader(data), size, opts)
+}
+
+func (bucket *memoryBucket) addVersion(objectname string, object *memoryObject) {
+	switch bucket.versioning {
+	case "":
+		return
+	case VersioningEnabled:
+		id := make([]byte, 16)
+		rand.Read(id)
+		object.versionId = hex.EncodeToString(id)
+	default:
+		object.versionId = nullVersionId
+		versions := bucket.versions[objectname][:0]
+		for _, v := range bucket.versions[objectname] {
+			if v.versionId != nullVersionId {
+				versions = append(versions, v)
+			}
+		}
+		bucket.versions[objectname] = versions
+	}
+	if object.info.Metadata == nil {
+		object.info.Metadata = make(http.Header)
+	}
+	object.info.Metadata.Set(headerVersionId, object.versionId)
+	bucket.versions[objectname] = append(bucket.versions[objectname], object)
+}
+
+// 删除版本后重新确定最新版本，最新版本为删除标记时对象不可见
+func (bucket *memoryBucket) refreshLatest(objectname string) {
+	versions := bucket.versions[objectname]
+	if len(versions) == 0 {
+		delete(bucket.versions, objectname)
+		delete(bucket.objects, objectname)
+		return
+	}
+	if latest := versions[len(versions)-1]; latest.deleteMarker {
+		delete(bucket.objects, objectname)
+	} else {
+		bucket.objects[objectname] = latest
+	}
+}
+
+// 查找指定版本，versionId 为空时返回最新版本
+func (s *memoryStore) getVersion(bucketname, objectname, versionId string) (*memoryObject, error) {
+	if versionId == "" {
+		return s.getObject(bucketname, objectname)
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	bucket, ok := s.buckets[bucketname]
+	if !ok {
+		return nil, errNoSuchBucket(bucketname)
+	}
+	versions := bucket.versions[objectname]
+	// 从未开启版本控制的桶，对象只有 null 版本
+	if bucket.versioning == "" && versionId == nullVersionId {
+		if object, ok := bucket.objects[objectname]; ok {
+			return object, nil
+		}
+	}
+	for _, v := range versions {
+		if v.versionId != versionId {
+			continue
+		}
+		if v.deleteMarker {
+			return nil, memoryError("MethodNotAllowed", "The specified method is not allowed against this resource.", bucketname, objectname, http.StatusMethodNotAllowed)
+		}
+		return v, nil
+	}
+	return nil, memoryError("NoSuchVersion", "The specified version does not exist.", bucketname, objectname, http.StatusNotFound)
+}
+
+func (s *memoryStore) StatObjectVersion(bucketname, objectname, versionId string) (minio.ObjectInfo, error) {
+	object, err := s.getVersion(bucketname, objectname, versionId)
+	if err != nil {
+		return minio.ObjectInfo{}, err
+	}
+	return object.info, nil
+}
+
+func (s *memoryStore) GetObjectVersion(bucketname, objectname, versionId string) (StoreObject, error) {
+	object, err := s.getVersion(bucketname, objectname, versionId)
+	if err != nil {
+		return nil, err
+	}
+	return &memoryReader{Reader: bytes.NewReader(object.data), info: object.info}, nil
+}
+
+func (s *memoryStore) RemoveObjectVersions(bucketname string, versions []ObjectVersion) ([]ObjectVersion, error) {
+	if len(versions) > maxRemoveVersions {
+		return nil, memoryError("MalformedXML", "The XML you provided was not well-formed or did not validate against our published schema.", bucketname, "", http.StatusBadRequest)
+	}
+	failed := make([]ObjectVersion, 0)
+	for _, v := range versions {
+		if err := s.RemoveObjectVersion(bucketname, v.Key, v.VersionId); err != nil {
+			failed = append(failed, v)
+		}
+	}
+	return failed, nil
+}
+
+func (s *memoryStore) RemoveObjectVersion(bucketname, objectname, versionId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	bucket, ok := s.buckets[bucketname]
+	if !ok {
+		return errNoSuchBucket(bucketname)
+	}
+	if bucket.versioning == "" && versionId == nullVersionId {
+		delete(bucket.objects, objectname)
+		return nil
+	}
+	versions := bucket.versions[objectname]
+	for i, v := range versions {
+		if v.versionId == versionId {
+			bucket.versions[objectname] = append(versions[:i:i], versions[i+1:]...)
+			bucket.refreshLatest(objectname)
+			return nil
+		}
+	}
+	return memoryError("NoSuchVersion", "The specified version does not exist.", bucketname, objectname, http.StatusNotFound)
+}
+
+// keyMarker、versionIdMarker 为上一页最后一个版本
+func (s *memoryStore) ListObjectVersions(bucketname, prefix, keyMarker, versionIdMarker string, maxKeys int) (ListVersionsResult, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	bucket, ok := s.buckets[bucketname]
+	if !ok {
+		return ListVersionsResult{}, errNoSuchBucket(bucketname)
+	}
+	if maxKeys <= 0 || maxKeys > 1000 {
+		maxKeys = 1000
+	}
+
+	set := make(map[string]bool)
+	for name := range bucket.objects {
+		set[name] = true
+	}
+	for name := range bucket.versions {
+		set[name] = true
+	}
+	names := make([]string, 0, len(set))
+	for name := range set {
+		if strings.HasPrefix(name, prefix) && name >= keyMarker {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	result := ListVersionsResult{Versions: make([]ObjectVersion, 0)}
+	for _, name := range names {
+		versions := bucket.versions[name]
+		if len(versions) == 0 {
+			versions = []*memoryObject{bucket.objects[name]}
+		}
+		// 同一 key 从新到旧，跳过上一页已返回的版本
+		skip := name == keyMarker
+		for i := len(versions) - 1; i >= 0; i-- {
+			v := versions[i]
+			versionId := v.versionId
+			if versionId == "" {
+				versionId = nullVersionId
+			}
+			if skip {
+				if versionIdMarker != "" && versionId == versionIdMarker {
+					skip = false
+				}
+				continue
+			}
+			if len(result.Versions) == maxKeys {
+				result.IsTruncated = true
+				last := result.Versions[len(result.Versions)-1]
+				result.NextKeyMarker = last.Key
+				result.NextVersionIdMarker = last.VersionId
+				return result, nil
+			}
+			result.Versions = append(result.Versions, ObjectVersion{
+				Key:            name,
+				VersionId:      versionId,
+				IsLatest:       i == len(versions)-1,
+				IsDeleteMarker: v.deleteMarker,
+				LastModified:   v.info.LastModified,
+				Size:           v.info.Size,
+				ETag:           v.info.ETag,
+			})
+		}
+	}
+	return result, nil
+}
+
+func (s *memoryStore) getObject(bucketname, objectname string) (*memoryObject, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	bucket, ok := s.buckets[bucketname]
+	if !ok {
+		return nil, errNoSuchBucket(bucketname)
+	}
+	object, ok := bucket.objects[objectname]
+	if !ok {
+		return nil, errNoSuchKey(bucketname, objectname)
+	}
+	return object, nil
+}
+
+func (s *memoryStore) SetObjectTagging(bucketname, objectname string, tags map[string]string) error {
+	object, err := s.getObject(bucketname, objectname)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	object.tags = make(map[string]string, len(tags))
+	for k, v := range tags {
+		object.tags[k] = v
+	}
+	return nil
+}
+
+func (s *memoryStore) GetObjectTagging(bucketname, objectname string) (map[string]string, error) {
+	object, err := s.getObject(bucketname, objectname)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	tags := make(map[string]string, len(object.tags))
+	for k, v := range object.tags {
+		tags[k] = v
+	}
+	return tags, nil
+}
+
+func (s *memoryStore) GetObject(bucketname, objectname string, opts minio.GetObjectOptions) (StoreObject, error) {
+	object, err := s.getObject(bucketname, objectname)
+	if err != nil {
+		return nil, err
+	}
+	return &memoryReader{Reader: bytes.NewReader(object.data), info: object.info}, nil
+}
+
+func (s *memoryStore) StatObject(bucketname, objectname string, opts minio.StatObjectOptions) (minio.ObjectInfo, error) {
+	object, err := s.getObject(bucketname, objectname)
+	if err != nil {
+		return minio.ObjectInfo{}, err
+	}
+	return object.info, nil
+}
+
+func (s *memoryStore) ListObjects(bucketname, prefix string, recursive bool, doneCh <-chan struct{}) <-chan minio.ObjectInfo {
+	s.mu.RLock()
+	infos := make([]minio.ObjectInfo, 0)
+	prefixes := make(map[string]bool)
+	bucket, ok := s.buckets[bucketname]
+	if !ok {
+		infos = append(infos, minio.ObjectInfo{Err: errNoSuchBucket(bucketname)})
+	} else {
+		for name, object := range bucket.objects {
+			if !strings.HasPrefix(name, prefix) {
+				continue
+			}
+			if !recursive {
+				if i := strings.Index(name[len(prefix):], "/"); i >= 0 {
+					dir := name[:len(prefix)+i+1]
+					if !prefixes[dir] {
+						prefixes[dir] = true
+						infos = append(infos, minio.ObjectInfo{Key: dir})
+					}
+					continue
+				}
+			}
+			infos = append(infos, object.info)
+		}
+	}
+	s.mu.RUnlock()
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Key < infos[j].Key })
+
+	ch := make(chan minio.ObjectInfo)
+	go func() {
+		defer close(ch)
+		for _, info := range infos {
+			select {
+			case ch <- info:
+			case <-doneCh:
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// continuationToken 为上一页最后一个 key 的 base64 编码
+func (s *memoryStore) ListObjectsV2(bucketname, prefix, continuationToken, delimiter string, maxKeys int) (minio.ListBucketV2Result, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	bucket, ok := s.buckets[bucketname]
+	if !ok {
+		return minio.ListBucketV2Result{}, errNoSuchBucket(bucketname)
+	}
+	startAfter := ""
+	if continuationToken != "" {
+		token, err := base64.RawURLEncoding.DecodeString(continuationToken)
+		if err != nil {
+			return minio.ListBucketV2Result{}, memoryError("InvalidArgument", "The continuation token provided is incorrect", bucketname, "", http.StatusBadRequest)
+		}
+		startAfter = string(token)
+	}
+	if maxKeys <= 0 || maxKeys > 1000 {
+		maxKeys = 1000
+	}
+
+	names := make([]string, 0)
+	for name := range bucket.objects {
+		if strings.HasPrefix(name, prefix) && name > startAfter {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	result := minio.ListBucketV2Result{
+		Name:              bucketname,
+		Prefix:            prefix,
+		Delimiter:         delimiter,
+		MaxKeys:           int64(maxKeys),
+		ContinuationToken: continuationToken,
+	}
+	last := ""
+	count := 0
+	for _, name := range names {
+		entry := name
+		isPrefix := false
+		if delimiter != "" {
+			if i := strings.Index(name[len(prefix):], delimiter); i >= 0 {
+				entry = name[:len(prefix)+i+len(delimiter)]
+				isPrefix = true
+			}
+		}
+		// 同一目录只返回一次，跨页时上一页已返回的目录也要跳过
+		if isPrefix && (entry == last || entry <= startAfter) {
+			continue
+		}
+		if count == maxKeys {
+			result.IsTruncated = true
+			result.NextContinuationToken = base64.RawURLEncoding.EncodeToString([]byte(last))
+			break
+		}
+		if isPrefix {
+			result.CommonPrefixes = append(result.CommonPrefixes, minio.CommonPrefix{Prefix: entry})
+		} else {
+			result.Contents = append(result.Contents, bucket.objects[name].info)
+		}
+		last = entry
+		count++
+	}
+	return result, nil
+}
+
+func (s *memoryStore) RemoveObject(bucketname, objectname string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	bucket, ok := s.buckets[bucketname]
+	if !ok {
+		return errNoSuchBucket(bucketname)
+	}
+	// 开启过版本控制时写入删除标记，历史版本保留
+	if bucket.versioning != "" {
+		bucket.addVersion(objectname, &memoryObject{
+			deleteMarker: true,
+			info:         minio.ObjectInfo{Key: objectname, LastModified: time.Now().UTC()},
+		})
+	}
+	delete(bucket.objects, objectname)
+	return nil
+}
+
+func (s *memoryStore) RemoveObjects(bucketname string, objectsCh <-chan string) <-chan minio.RemoveObjectError {
+	ch := make(chan minio.RemoveObjectError)
+	go func() {
+		defer close(ch)
+		for name := range objectsCh {
+			if err := s.RemoveObject(bucketname, name); err != nil {
+				ch <- minio.RemoveObjectError{ObjectName: name, Err: err}
+			}
+		}
+	}()
+	return ch
+}
+
+func (s *memoryStore) ComposeObject(bucketname, objectname string, srcs []SrcInfo, userMeta map[string]string) error {
+	var buf bytes.Buffer
+	for _, v := range srcs {
+		object, err := s.getObject(bucketname, v.Name)
+		if err != nil {
+			return err
+		}
+		if v.Etag != "" && removeBackslashAndQuotes(v.Etag) != object.info.ETag {
+			return memoryError("PreconditionFailed", "At least one of the pre-conditions you specified did not hold", bucketname, v.Name, http.StatusPreconditionFailed)
+		}
+		buf.Write(object.data)
+	}
+	_, err := s.PutObject(bucketname, objectname, &buf, int64(buf.Len()), memoryPutOptions(userMeta))
+	return err
+}
+
+// 与 minio 一致，userMeta 中的 Content-Type 作为标准请求头而不是自定义元数据
+func memoryPutOptions(userMeta map[string]string) minio.PutObjectOptions {
+	opts := minio.PutObjectOptions{UserMetadata: make(map[string]string)}
+	for k, v := range userMeta {
+		if strings.EqualFold(k, "Content-Type") {
+			opts.ContentType = v
+		} else {
+			opts.UserMetadata[k] = v
+		}
+	}
+	return opts
+}
+
+func (s *memoryStore) CopyObject(bucketname, objectname string, src CopySrc, userMeta map[string]string) error {
+	object, err := s.getObject(src.BucketName, src.Name)
+	if err != nil {
+		return err
+	}
+	if src.Etag != "" && removeBackslashAndQuotes(src.Etag) != object.info.ETag {
+		return memoryError("PreconditionFailed", "At least one of the pre-conditions you specified did not hold", src.BucketName, src.Name, http.StatusPreconditionFailed)
+	}
+	opts := memoryPutOptions(userMeta)
+	if opts.ContentType == "" {
+		opts.ContentType = object.info.ContentType
+	}
+	if userMeta == nil {
+		for k, v := range object.info.Metadata {
+			if strings.HasPrefix(strings.ToLower(k), "x-amz-meta-") {
+				opts.UserMetadata[k[len("x-amz-meta-"):]] = v[0]
+			}
+		}
+	}
+	// 与 S3 一致，复制时默认保留源对象的标签
+	if len(object.tags) > 0 {
+		opts.UserMetadata[headerTagging] = encodeTagging(object.tags)
+	}
+	_, err = s.PutObject(bucketname, objectname, bytes.NewReader(object.data), int64(len(object.data)), opts)
+	return err
+}
+
+func (s *memoryStore) getUpload(bucketname, objectname, uploadID string) (*memoryUpload, error) {
+	upload, ok := s.uploads[uploadID]
+	if !ok || upload.bucketname != bucketname || upload.objectname != objectname {
+		return nil, memoryError("NoSuchUpload", "The specified multipart upload does not exist.", bucketname, objectname, http.StatusNotFound)
+	}
+	return upload, nil
+}
+
+func (s *memoryStore) NewMultipartUpload(bucketname, objectname string, opts minio.PutObjectOptions) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.buckets[bucketname]; !ok {
+		return "", errNoSuchBucket(bucketname)
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	uploadID := hex.EncodeToString(id)
+	s.uploads[uploadID] = &memoryUpload{
+		bucketname: bucketname,
+		objectname: objectname,
+		opts:       opts,
+		initiated:  time.Now(),
+		parts:      make(map[int]*memoryObject),
+	}
+	return uploadID, nil
+}
+
+func (s *memoryStore) PutObjectPart(bucketname, objectname, uploadID string, partNumber int, reader io.Reader, size int64) (minio.ObjectPart, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return minio.ObjectPart{}, err
+	}
+	if size >= 0 && int64(len(data)) != size {
+		return minio.ObjectPart{}, memoryError("IncompleteBody", "You did not provide the number of bytes specified by the Content-Length HTTP header.", bucketname, objectname, http.StatusBadRequest)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	upload, err := s.getUpload(bucketname, objectname, uploadID)
+	if err != nil {
+		return minio.ObjectPart{}, err
+	}
+	sum := md5.Sum(data)
+	part := &memoryObject{
+		data: data,
+		info: minio.ObjectInfo{
+			ETag:         hex.EncodeToString(sum[:]),
+			LastModified: time.Now().UTC(),
+			Size:         int64(len(data)),
+		},
+	}
+	upload.parts[partNumber] = part
+	return minio.ObjectPart{
+		PartNumber:   partNumber,
+		LastModified: part.info.LastModified,
+		ETag:         part.info.ETag,
+		Size:         part.info.Size,
+	}, nil
+}
+
+func (s *memoryStore) ListObjectParts(bucketname, objectname, uploadID string) ([]minio.ObjectPart, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	upload, err := s.getUpload(bucketname, objectname, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	parts := make([]minio.ObjectPart, 0, len(upload.parts))
+	for number, part := range upload.parts {
+		parts = append(parts, minio.ObjectPart{
+			PartNumber:   number,
+			LastModified: part.info.LastModified,
+			ETag:         part.info.ETag,
+			Size:         part.info.Size,
+		})
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].PartNumber < parts[j].PartNumber })
+	return parts, nil
+}
+
+func (s *memoryStore) CompleteMultipartUpload(bucketname, objectname, uploadID string, parts []minio.CompletePart) (string, error) {
+	s.mu.Lock()
+	upload, err := s.getUpload(bucketname, objectname, uploadID)
+	if err != nil {
+		s.mu.Unlock()
+		return "", err
+	}
+	var buf bytes.Buffer
+	sums := md5.New()
+	for i, v := range parts {
+		part, ok := upload.parts[v.PartNumber]
+		if !ok || removeBackslashAndQuotes(v.ETag) != part.info.ETag {
+			s.mu.Unlock()
+			return "", memoryError("InvalidPart", "One or more of the specified parts could not be found.", bucketname, objectname, http.StatusBadRequest)
+		}
+		if i > 0 && parts[i-1].PartNumber >= v.PartNumber {
+			s.mu.Unlock()
+			return "", memoryError("InvalidPartOrder", "The list of parts was not in ascending order.", bucketname, objectname, http.StatusBadRequest)
+		}
+		if i < len(parts)-1 && part.info.Size < minPartSize {
+			s.mu.Unlock()
+			return "", memoryError("EntityTooSmall", "Your proposed upload is smaller than the minimum allowed object size.", bucketname, objectname, http.StatusBadRequest)
+		}
+		sum, _ := hex.DecodeString(part.info.ETag)
+		sums.Write(sum)
+		buf.Write(part.data)
+	}
+	delete(s.uploads, uploadID)
+	s.mu.Unlock()
+
+	if _, err := s.PutObject(bucketname, objectname, &buf, int64(buf.Len()), upload.opts); err != nil {
+		return "", err
+	}
+	// 与 S3 一致，分段上传对象的 ETag 为各分段 md5 拼接后的 md5 加分段数
+	etag := fmt.Sprintf("%s-%d", hex.EncodeToString(sums.Sum(nil)), len(parts))
+	s.mu.Lock()
+	if object, ok := s.buckets[bucketname].objects[objectname]; ok {
+		object.info.ETag = etag
+	}
+	s.mu.Unlock()
+	return etag, nil
+}
+
+func (s *memoryStore) AbortMultipartUpload(bucketname, objectname, uploadID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.getUpload(bucketname, objectname, uploadID); err != nil {
+		return err
+	}
+	delete(s.uploads, uploadID)
+	return nil
+}
+
+func (s *memoryStore) ListIncompleteUploads(bucketname, prefix string, recursive bool, doneCh <-chan struct{}) <-chan minio.ObjectMultipartInfo {
+	s.mu.RLock()
+	infos := make([]minio.ObjectMultipartInfo, 0)
+	if _, ok := s.buckets[bucketname]; !ok {
+		infos = append(infos, minio.ObjectMultipartInfo{Err: errNoSuchBucket(bucketname)})
+	}
+	for id, upload := range s.uploads {
+		if upload.bucketname != bucketname || !strings.HasPrefix(upload.objectname, prefix) {
+			continue
+		}
+		if !recursive && strings.Contains(upload.objectname[len(prefix):], "/") {
+			continue
+		}
+		var size int64
+		for _, part := range upload.parts {
+			size += part.info.Size
+		}
+		infos = append(infos, minio.ObjectMultipartInfo{
+			Initiated: upload.initiated,
+			Key:       upload.objectname,
+			Size:      size,
+			UploadID:  id,
+		})
+	}
+	s.mu.RUnlock()
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Key < infos[j].Key })
+
+	ch := make(chan minio.ObjectMultipartInfo)
+	go func() {
+		defer close(ch)
+		for _, info := range infos {
+			select {
+			case ch <- info:
+			case <-doneCh:
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// 内存实现没有可供客户端直接访问的地址
+func errNotImplemented() error {
+	return memoryError("NotImplemented", "A header you provided implies functionality that is not implemented", "", "", http.StatusNotImplemented)
+}
+
+func (s *memoryStore) PresignedGetObject(bucketname, objectname string, expires time.Duration, reqParams url.Values) (*url.URL, error) {
+	return nil, errNotImplemented()
+}
+
+func (s *memoryStore) PresignedPutObject(bucketname, objectname string, expires time.Duration) (*url.URL, error) {
+	return nil, errNotImplemented()
+}
+
+func (s *memoryStore) PresignedPostPolicy(policy *minio.PostPolicy) (*url.URL, map[string]string, error) {
+	return nil, nil, errNotImplemented()
+}
+
+// 内存对象读取器
+type memoryReader struct {
+	*bytes.Reader
+	info minio.ObjectInfo
+}
+
+func (m *memoryReader) Close() error {
+	return nil
+}
+
+func (m *memoryReader) Stat() (minio.ObjectInfo, error) {
+	return m.info, nil
+}
@@ -0,0 +1,667 @@
+package common
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"io"
+	"minio_demo/config"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/minio/minio-go"
+	"github.com/minio/minio-go/pkg/s3signer"
+	"github.com/minio/minio-go/pkg/s3utils"
+	"github.com/zituocn/logx"
+)
+
+// minio-go v6 客户端实现
+// 直接发送的签名请求的超时时间，请求体都在内存中，不会传输大文件
+// 上传对象内容的请求耗时与文件大小有关，与 minio-go 客户端一致不设置超时
+const storeRequestTimeout = 30 * time.Second
+
+type minioStore struct {
+	client *minio.Client
+	core   minio.Core
+	// minio-go v6 未提供的接口直接发送签名请求
+	endpoint     string
+	conf         config.Minio
+	httpClient   *http.Client
+	uploadClient *http.Client
+}
+
+func NewMinioStore(client *minio.Client, conf config.Minio) ObjectStore {
+	scheme := "http://"
+	if conf.UseSSL {
+		scheme = "https://"
+	}
+	return &minioStore{
+		client:   client,
+		core:     minio.Core{Client: client},
+		endpoint: scheme + conf.Address + ":" + strconv.Itoa(conf.Port),
+		conf:     conf,
+		// 与 minio-go 客户端共用连接池
+		httpClient:   &http.Client{Transport: minio.DefaultTransport, Timeout: storeRequestTimeout},
+		uploadClient: &http.Client{Transport: minio.DefaultTransport},
+	}
+}
+
+// 发送签名请求，存储端返回错误时解析为 minio.ErrorResponse，调用方负责关闭响应
+func (s *minioStore) request(method, bucketname, objectname string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	req, err := s.newRequest(method, bucketname, objectname, query, header, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(body)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(sum[:]))
+	if len(body) > 0 {
+		md5sum := md5.Sum(body)
+		req.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(md5sum[:]))
+	}
+	return s.send(s.httpClient, req, bucketname, objectname, query)
+}
+
+func (s *minioStore) newRequest(method, bucketname, objectname string, query url.Values, header http.Header, body io.Reader) (*http.Request, error) {
+	u := s.endpoint + "/" + bucketname
+	if objectname != "" {
+		u += "/" + s3utils.EncodePath(objectname)
+	}
+	if len(query) > 0 {
+		// ?versioning 这类子资源没有值，Encode 会输出 versioning=，S3 同样接受
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	return req, nil
+}
+
+// 签名后发送请求，存储端返回错误时解析为 minio.ErrorResponse
+func (s *minioStore) send(client *http.Client, req *http.Request, bucketname, objectname string, query url.Values) (*http.Response, error) {
+	region := s.conf.Region
+	if region == "" {
+		region = defaultRegion
+	}
+	req = s3signer.SignV4(*req, s.conf.AccessKeyID, s.conf.SecretAccessKey, "", region)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < http.StatusBadRequest {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	errResp := minio.ErrorResponse{StatusCode: resp.StatusCode, BucketName: bucketname, Key: objectname}
+	if err := xml.Unmarshal(data, &errResp); err != nil || errResp.Code == "" {
+		// HEAD 请求的错误响应没有内容，按状态码确定错误码
+		switch {
+		case resp.StatusCode == http.StatusNotFound && query.Get("versionId") != "":
+			errResp.Code = "NoSuchVersion"
+		case resp.StatusCode == http.StatusNotFound:
+			errResp.Code = "NoSuchKey"
+		case resp.StatusCode == http.StatusMethodNotAllowed:
+			errResp.Code = "MethodNotAllowed"
+		default:
+			errResp.Code = resp.Status
+		}
+		errResp.Message = string(data)
+	}
+	return nil, errResp
+}
+
+// 发送签名请求，返回响应内容
+func (s *minioStore) do(method, bucketname, objectname string, query url.Values, body []byte) ([]byte, error) {
+	resp, err := s.request(method, bucketname, objectname, query, nil, body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+func (s *minioStore) MakeBucket(bucketname, location string) error {
+	return s.client.MakeBucket(bucketname, location)
+}
+
+func (s *minioStore) SetBucketPolicy(bucketname, policy string) error {
+	return s.client.SetBucketPolicy(bucketname, policy)
+}
+
+func (s *minioStore) GetBucketLifecycle(bucketname string) (string, error) {
+	return s.client.GetBucketLifecycle(bucketname)
+}
+
+func (s *minioStore) SetBucketLifecycle(bucketname, lifecycle string) error {
+	return s.client.SetBucketLifecycle(bucketname, lifecycle)
+}
+
+type versioningConfiguration struct {
+	XMLName xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ VersioningConfiguration"`
+	Status  string   `xml:"Status,omitempty"`
+}
+
+func (s *minioStore) SetBucketVersioning(bucketname string, enabled bool) error {
+	conf := versioningConfiguration{Status: "Suspended"}
+	if enabled {
+		conf.Status = "Enabled"
+	}
+	body, err := xml.Marshal(conf)
+	if err != nil {
+		return err
+	}
+	_, err = s.do(http.MethodPut, bucketname, "", url.Values{"versioning": {""}}, body)
+	return err
+}
+
+type tagging struct {
+	XMLName xml.Name `xml:"Tagging"`
+	TagSet  []tag    `xml:"TagSet>Tag"`
+}
+
+type tag struct {
+	Key   string `xml:"Key"`
+	Value string `xml:"Value"`
+}
+
+func newTagging(tags map[string]string) tagging {
+	t := tagging{TagSet: make([]tag, 0, len(tags))}
+	for k, v := range tags {
+		t.TagSet = append(t.TagSet, tag{Key: k, Value: v})
+	}
+	sort.Slice(t.TagSet, func(i, j int) bool { return t.TagSet[i].Key < t.TagSet[j].Key })
+	return t
+}
+
+func (s *minioStore) SetBucketTagging(bucketname string, tags map[string]string) error {
+	body, err := xml.Marshal(newTagging(tags))
+	if err != nil {
+		return err
+	}
+	_, err = s.do(http.MethodPut, bucketname, "", url.Values{"tagging": {""}}, body)
+	return err
+}
+
+func (s *minioStore) RemoveBucket(bucketname string) error {
+	return s.client.RemoveBucket(bucketname)
+}
+
+func (s *minioStore) BucketExists(bucketname string) (bool, error) {
+	return s.client.BucketExists(bucketname)
+}
+
+func (s *minioStore) ListBuckets() ([]minio.BucketInfo, error) {
+	return s.client.ListBuckets()
+}
+
+func (s *minioStore) SetObjectTagging(bucketname, objectname string, tags map[string]string) error {
+	if len(tags) == 0 {
+		_, err := s.do(http.MethodDelete, bucketname, objectname, url.Values{"tagging": {""}}, nil)
+		return err
+	}
+	body, err := xml.Marshal(newTagging(tags))
+	if err != nil {
+		return err
+	}
+	_, err = s.do(http.MethodPut, bucketname, objectname, url.Values{"tagging": {""}}, body)
+	return err
+}
+
+func (s *minioStore) GetObjectTagging(bucketname, objectname string) (map[string]string, error) {
+	data, err := s.do(http.MethodGet, bucketname, objectname, url.Values{"tagging": {""}}, nil)
+	if err != nil {
+		return nil, err
+	}
+	t := tagging{}
+	if err := xml.Unmarshal(data, &t); err != nil {
+		return nil, err
+	}
+	tags := make(map[string]string, len(t.TagSet))
+	for _, v := range t.TagSet {
+		tags[v.Key] = v.Value
+	}
+	return tags, nil
+}
+
+func (s *minioStore) PutObject(bucketname, objectname string, reader io.Reader, size int64, opts minio.PutObjectOptions) (int64, error) {
+	if _, ok := opts.UserMetadata[headerTagging]; ok {
+		return s.putObjectTagged(bucketname, objectname, reader, size, "", opts)
+	}
+	return s.client.PutObject(bucketname, objectname, reader, size, opts)
+}
+
+func (s *minioStore) PutObjectMd5(bucketname, objectname string, reader io.Reader, size int64, md5Base64 string, opts minio.PutObjectOptions) (int64, error) {
+	if _, ok := opts.UserMetadata[headerTagging]; ok {
+		return s.putObjectTagged(bucketname, objectname, reader, size, md5Base64, opts)
+	}
+	// Core.PutObject 只接受元数据 map，按 PutObjectOptions 生成的请求头传入
+	meta := make(map[string]string)
+	for k, v := range opts.Header() {
+		meta[k] = v[0]
+	}
+	info, err := s.core.PutObject(bucketname, objectname, reader, size, md5Base64, "", meta, nil)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size, nil
+}
+
+// minio-go v6 会给 X-Amz-Tagging 加上 X-Amz-Meta- 前缀，带标签时直接发送单次 PUT
+// 请求体不签名，size 必须已知且不超过 maxSinglePutSize
+func (s *minioStore) putObjectTagged(bucketname, objectname string, reader io.Reader, size int64, md5Base64 string, opts minio.PutObjectOptions) (int64, error) {
+	meta := make(map[string]string, len(opts.UserMetadata))
+	for k, v := range opts.UserMetadata {
+		if k != headerTagging {
+			meta[k] = v
+		}
+	}
+	tagging := opts.UserMetadata[headerTagging]
+	opts.UserMetadata = meta
+	header := opts.Header()
+	header.Set(headerTagging, tagging)
+	header.Set("X-Amz-Content-Sha256", "UNSIGNED-PAYLOAD")
+	if md5Base64 != "" {
+		header.Set("Content-MD5", md5Base64)
+	}
+	req, err := s.newRequest(http.MethodPut, bucketname, objectname, nil, header, reader)
+	if err != nil {
+		return 0, err
+	}
+	req.ContentLength = size
+	resp, err := s.send(s.uploadClient, req, bucketname, objectname, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return size, nil
+}
+
+func (s *minioStore) GetObject(bucketname, objectname string, opts minio.GetObjectOptions) (StoreObject, error) {
+	object, err := s.client.GetObject(bucketname, objectname, opts)
+	if err != nil {
+		return nil, err
+	}
+	return object, nil
+}
+
+func (s *minioStore) StatObject(bucketname, objectname string, opts minio.StatObjectOptions) (minio.ObjectInfo, error) {
+	return s.client.StatObject(bucketname, objectname, opts)
+}
+
+func (s *minioStore) ListObjects(bucketname, prefix string, recursive bool, doneCh <-chan struct{}) <-chan minio.ObjectInfo {
+	return s.client.ListObjects(bucketname, prefix, recursive, doneCh)
+}
+
+func (s *minioStore) ListObjectsV2(bucketname, prefix, continuationToken, delimiter string, maxKeys int) (minio.ListBucketV2Result, error) {
+	return s.core.ListObjectsV2(bucketname, prefix, continuationToken, false, delimiter, maxKeys, "")
+}
+
+func (s *minioStore) RemoveObject(bucketname, objectname string) error {
+	return s.client.RemoveObject(bucketname, objectname)
+}
+
+func (s *minioStore) RemoveObjects(bucketname string, objectsCh <-chan string) <-chan minio.RemoveObjectError {
+	return s.client.RemoveObjects(bucketname, objectsCh)
+}
+
+func (s *minioStore) ComposeObject(bucketname, objectname string, srcs []SrcInfo, userMeta map[string]string) error {
+	src_list := make([]minio.SourceInfo, 0, len(srcs))
+	for _, v := range srcs {
+		item := minio.NewSourceInfo(bucketname, v.Name, nil)
+		item.SetMatchETagCond(v.Etag)
+		src_list = append(src_list, item)
+	}
+	dst, err := minio.NewDestinationInfo(bucketname, objectname, nil, userMeta)
+	if err != nil {
+		return err
+	}
+	return s.client.ComposeObject(dst, src_list)
+}
+
+// S3 单次 CopyObject 的最大对象大小，超过时使用分段复制
+const maxCopyObjectSize = 5 * 1024 * 1024 * 1024
+
+func (s *minioStore) CopyObject(bucketname, objectname string, src CopySrc, userMeta map[string]string) error {
+	item := minio.NewSourceInfo(src.BucketName, src.Name, nil)
+	if src.Etag != "" {
+		item.SetMatchETagCond(src.Etag)
+	}
+	dst, err := minio.NewDestinationInfo(bucketname, objectname, nil, userMeta)
+	if err != nil {
+		return err
+	}
+	if src.Size > maxCopyObjectSize {
+		return s.client.ComposeObject(dst, []minio.SourceInfo{item})
+	}
+	return s.client.CopyObject(dst, item)
+}
+
+func (s *minioStore) GetBucketVersioning(bucketname string) (string, error) {
+	data, err := s.do(http.MethodGet, bucketname, "", url.Values{"versioning": {""}}, nil)
+	if err != nil {
+		return "", err
+	}
+	conf := versioningConfiguration{}
+	if err := xml.Unmarshal(data, &conf); err != nil {
+		return "", err
+	}
+	return conf.Status, nil
+}
+
+type listVersionsResult struct {
+	IsTruncated         bool
+	NextKeyMarker       string
+	NextVersionIdMarker string
+	Versions            []xmlVersion `xml:"Version"`
+	DeleteMarkers       []xmlVersion `xml:"DeleteMarker"`
+}
+
+type xmlVersion struct {
+	Key          string
+	VersionId    string
+	IsLatest     bool
+	LastModified time.Time
+	ETag         string
+	Size         int64
+}
+
+func (s *minioStore) ListObjectVersions(bucketname, prefix, keyMarker, versionIdMarker string, maxKeys int) (ListVersionsResult, error) {
+	query := url.Values{"versions": {""}, "prefix": {prefix}, "max-keys": {strconv.Itoa(maxKeys)}}
+	if keyMarker != "" {
+		query.Set("key-marker", keyMarker)
+		query.Set("version-id-marker", versionIdMarker)
+	}
+	data, err := s.do(http.MethodGet, bucketname, "", query, nil)
+	if err != nil {
+		return ListVersionsResult{}, err
+	}
+	list := listVersionsResult{}
+	if err := xml.Unmarshal(data, &list); err != nil {
+		return ListVersionsResult{}, err
+	}
+
+	result := ListVersionsResult{
+		Versions:            make([]ObjectVersion, 0, len(list.Versions)+len(list.DeleteMarkers)),
+		IsTruncated:         list.IsTruncated,
+		NextKeyMarker:       list.NextKeyMarker,
+		NextVersionIdMarker: list.NextVersionIdMarker,
+	}
+	for _, v := range list.Versions {
+		result.Versions = append(result.Versions, ObjectVersion{
+			Key:          v.Key,
+			VersionId:    v.VersionId,
+			IsLatest:     v.IsLatest,
+			LastModified: v.LastModified,
+			Size:         v.Size,
+			ETag:         removeBackslashAndQuotes(v.ETag),
+		})
+	}
+	for _, v := range list.DeleteMarkers {
+		result.Versions = append(result.Versions, ObjectVersion{
+			Key:            v.Key,
+			VersionId:      v.VersionId,
+			IsLatest:       v.IsLatest,
+			IsDeleteMarker: true,
+			LastModified:   v.LastModified,
+		})
+	}
+	// XML 中版本和删除标记交错排列，分开解析后重新排序
+	sort.SliceStable(result.Versions, func(i, j int) bool {
+		a, b := result.Versions[i], result.Versions[j]
+		if a.Key != b.Key {
+			return a.Key < b.Key
+		}
+		return a.LastModified.After(b.LastModified)
+	})
+	return result, nil
+}
+
+func (s *minioStore) StatObjectVersion(bucketname, objectname, versionId string) (minio.ObjectInfo, error) {
+	if versionId == "" {
+		return s.StatObject(bucketname, objectname, minio.StatObjectOptions{})
+	}
+	resp, err := s.request(http.MethodHead, bucketname, objectname, url.Values{"versionId": {versionId}}, nil, nil)
+	if err != nil {
+		return minio.ObjectInfo{}, err
+	}
+	resp.Body.Close()
+	return headerObjectInfo(objectname, resp.Header), nil
+}
+
+// HEAD 响应头转换为对象信息
+func headerObjectInfo(objectname string, header http.Header) minio.ObjectInfo {
+	size, _ := strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+	lastModified, _ := time.Parse(http.TimeFormat, header.Get("Last-Modified"))
+	return minio.ObjectInfo{
+		ETag:         removeBackslashAndQuotes(header.Get("ETag")),
+		Key:          objectname,
+		LastModified: lastModified,
+		Size:         size,
+		ContentType:  header.Get("Content-Type"),
+		Metadata:     header,
+		StorageClass: header.Get(headerStorageClass),
+	}
+}
+
+func (s *minioStore) GetObjectVersion(bucketname, objectname, versionId string) (StoreObject, error) {
+	if versionId == "" {
+		return s.GetObject(bucketname, objectname, minio.GetObjectOptions{})
+	}
+	info, err := s.StatObjectVersion(bucketname, objectname, versionId)
+	if err != nil {
+		return nil, err
+	}
+	return &versionObject{store: s, bucketname: bucketname, versionId: versionId, info: info}, nil
+}
+
+func (s *minioStore) RemoveObjectVersion(bucketname, objectname, versionId string) error {
+	resp, err := s.request(http.MethodDelete, bucketname, objectname, url.Values{"versionId": {versionId}}, nil, nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+type deleteRequest struct {
+	XMLName xml.Name       `xml:"Delete"`
+	Quiet   bool           `xml:"Quiet"`
+	Objects []deleteObject `xml:"Object"`
+}
+
+type deleteObject struct {
+	Key       string
+	VersionId string `xml:"VersionId,omitempty"`
+}
+
+type deleteResult struct {
+	Errors []struct {
+		Key       string
+		VersionId string
+		Code      string
+		Message   string
+	} `xml:"Error"`
+}
+
+// minio-go v6 的 RemoveObjects 不支持版本，直接发送批量删除请求，只返回失败的版本
+func (s *minioStore) RemoveObjectVersions(bucketname string, versions []ObjectVersion) ([]ObjectVersion, error) {
+	if len(versions) > maxRemoveVersions {
+		return nil, errors.New("too many versions to remove")
+	}
+	req := deleteRequest{Quiet: true, Objects: make([]deleteObject, 0, len(versions))}
+	for _, v := range versions {
+		req.Objects = append(req.Objects, deleteObject{Key: v.Key, VersionId: v.VersionId})
+	}
+	body, err := xml.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	data, err := s.do(http.MethodPost, bucketname, "", url.Values{"delete": {""}}, body)
+	if err != nil {
+		return nil, err
+	}
+	result := deleteResult{}
+	if err := xml.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	failed := make(map[string]bool, len(result.Errors))
+	for _, e := range result.Errors {
+		logx.Errorf("remove version: bucketname:%s object:%s %s %s %s", bucketname, e.Key, e.VersionId, e.Code, e.Message)
+		failed[e.Key+"\x00"+e.VersionId] = true
+	}
+	fails := make([]ObjectVersion, 0, len(failed))
+	for _, v := range versions {
+		if failed[v.Key+"\x00"+v.VersionId] {
+			fails = append(fails, v)
+		}
+	}
+	return fails, nil
+}
+
+// 读取指定版本的对象，按当前位置发送 Range 请求，支持 Seek 和 ReadAt
+type versionObject struct {
+	store      *minioStore
+	bucketname string
+	versionId  string
+	info       minio.ObjectInfo
+	offset     int64
+	body       io.ReadCloser
+}
+
+func (o *versionObject) get(start, end int64) (io.ReadCloser, error) {
+	header := http.Header{}
+	if end >= 0 {
+		header.Set("Range", "bytes="+strconv.FormatInt(start, 10)+"-"+strconv.FormatInt(end, 10))
+	} else {
+		header.Set("Range", "bytes="+strconv.FormatInt(start, 10)+"-")
+	}
+	resp, err := o.store.request(http.MethodGet, o.bucketname, o.info.Key, url.Values{"versionId": {o.versionId}}, header, nil)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (o *versionObject) Read(p []byte) (int, error) {
+	if o.offset >= o.info.Size {
+		return 0, io.EOF
+	}
+	if o.body == nil {
+		body, err := o.get(o.offset, -1)
+		if err != nil {
+			return 0, err
+		}
+		o.body = body
+	}
+	n, err := o.body.Read(p)
+	o.offset += int64(n)
+	return n, err
+}
+
+func (o *versionObject) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += o.offset
+	case io.SeekEnd:
+		offset += o.info.Size
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	if offset != o.offset && o.body != nil {
+		o.body.Close()
+		o.body = nil
+	}
+	o.offset = offset
+	return offset, nil
+}
+
+func (o *versionObject) ReadAt(p []byte, off int64) (int, error) {
+	if off >= o.info.Size {
+		return 0, io.EOF
+	}
+	end := off + int64(len(p)) - 1
+	if end >= o.info.Size {
+		end = o.info.Size - 1
+	}
+	body, err := o.get(off, end)
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+	n, err := io.ReadFull(body, p[:end-off+1])
+	if err == nil && n < len(p) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (o *versionObject) Close() error {
+	if o.body != nil {
+		return o.body.Close()
+	}
+	return nil
+}
+
+func (o *versionObject) Stat() (minio.ObjectInfo, error) {
+	return o.info, nil
+}
+
+func (s *minioStore) NewMultipartUpload(bucketname, objectname string, opts minio.PutObjectOptions) (string, error) {
+	return s.core.NewMultipartUpload(bucketname, objectname, opts)
+}
+
+func (s *minioStore) PutObjectPart(bucketname, objectname, uploadID string, partNumber int, reader io.Reader, size int64) (minio.ObjectPart, error) {
+	return s.core.PutObjectPart(bucketname, objectname, uploadID, partNumber, reader, size, "", "", nil)
+}
+
+func (s *minioStore) ListObjectParts(bucketname, objectname, uploadID string) ([]minio.ObjectPart, error) {
+	parts := make([]minio.ObjectPart, 0)
+	marker := 0
+	for {
+		result, err := s.core.ListObjectParts(bucketname, objectname, uploadID, marker, 1000)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, result.ObjectParts...)
+		if !result.IsTruncated {
+			return parts, nil
+		}
+		marker = result.NextPartNumberMarker
+	}
+}
+
+func (s *minioStore) CompleteMultipartUpload(bucketname, objectname, uploadID string, parts []minio.CompletePart) (string, error) {
+	return s.core.CompleteMultipartUpload(bucketname, objectname, uploadID, parts)
+}
+
+func (s *minioStore) AbortMultipartUpload(bucketname, objectname, uploadID string) error {
+	return s.core.AbortMultipartUpload(bucketname, objectname, uploadID)
+}
+
+func (s *minioStore) ListIncompleteUploads(bucketname, prefix string, recursive bool, doneCh <-chan struct{}) <-chan minio.ObjectMultipartInfo {
+	return s.client.ListIncompleteUploads(bucketname, prefix, recursive, doneCh)
+}
+
+func (s *minioStore) PresignedGetObject(bucketname, objectname string, expires time.Duration, reqParams url.Values) (*url.URL, error) {
+	return s.client.PresignedGetObject(bucketname, objectname, expires, reqParams)
+}
+
+func (s *minioStore) PresignedPutObject(bucketname, objectname string, expires time.Duration) (*url.URL, error) {
+	return s.client.PresignedPutObject(bucketname, objectname, expires)
+}
+
+func (s *minioStore) PresignedPostPolicy(policy *minio.PostPolicy) (*url.URL, map[string]string, error) {
+	return s.client.PresignedPostPolicy(policy)
+}
@@ -0,0 +1,351 @@
+package common
+
+import (
+	"io"
+	"minio_demo/errorx"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go"
+	"github.com/zituocn/logx"
+)
+
+// 统计桶已用容量的对象存储，只统计设置了配额的桶
+// 开启过版本控制的桶覆盖和删除对象时保留历史版本，只在永久删除版本时扣减；
+// 暂停版本控制和生命周期过期造成的偏差由清理任务重新统计修正
+type usageStore struct {
+	ObjectStore
+	mu sync.Mutex
+	// 桶的版本控制状态，其他实例修改时最多 versioningCacheTTL 后生效
+	versioning map[string]cachedVersioning
+}
+
+type cachedVersioning struct {
+	status  string
+	expires time.Time
+}
+
+const versioningCacheTTL = time.Minute
+
+func newUsageStore(s ObjectStore) ObjectStore {
+	if _, ok := s.(*usageStore); ok {
+		return s
+	}
+	return &usageStore{ObjectStore: s, versioning: make(map[string]cachedVersioning)}
+}
+
+// 桶的存储配额，0 表示未设置，不统计
+func (s *usageStore) quota(bucketname string) int64 {
+	quota, err := metadata.GetBucketQuota(bucketname)
+	if err != nil {
+		logx.Error("metadata GetBucketQuota error:", err.Error())
+		return 0
+	}
+	return quota
+}
+
+// 桶是否设置了配额
+func (s *usageStore) tracked(bucketname string) bool {
+	return s.quota(bucketname) > 0
+}
+
+// 未开启过版本控制时覆盖对象会删除旧对象
+func (s *usageStore) unversioned(bucketname string) bool {
+	s.mu.Lock()
+	v, ok := s.versioning[bucketname]
+	s.mu.Unlock()
+	if ok && time.Now().Before(v.expires) {
+		return v.status == ""
+	}
+	status, err := s.ObjectStore.GetBucketVersioning(bucketname)
+	if err != nil {
+		return false
+	}
+	s.mu.Lock()
+	s.versioning[bucketname] = cachedVersioning{status: status, expires: time.Now().Add(versioningCacheTTL)}
+	s.mu.Unlock()
+	return status == ""
+}
+
+func (s *usageStore) forget(bucketname string) {
+	s.mu.Lock()
+	delete(s.versioning, bucketname)
+	s.mu.Unlock()
+}
+
+// 对象不存在时返回 0
+func (s *usageStore) size(bucketname, objectname string) int64 {
+	stat, err := s.ObjectStore.StatObject(bucketname, objectname, minio.StatObjectOptions{})
+	if err != nil {
+		return 0
+	}
+	return stat.Size
+}
+
+// 删除的对象大小，优先使用文件记录，没有记录的对象再查询存储
+func (s *usageStore) sizes(bucketname string, objectnames []string) map[string]int64 {
+	records, err := metadata.GetByNames(bucketname, objectnames)
+	if err != nil {
+		logx.Error("metadata GetByNames error:", err.Error())
+	}
+	sizes := make(map[string]int64, len(objectnames))
+	for _, name := range objectnames {
+		if record, ok := records[name]; ok {
+			sizes[name] = record.Size
+		} else {
+			sizes[name] = s.size(bucketname, name)
+		}
+	}
+	return sizes
+}
+
+// 写入前未开启版本控制的桶内同名对象大小
+func (s *usageStore) replaced(bucketname, objectname string) int64 {
+	if !s.unversioned(bucketname) {
+		return 0
+	}
+	return s.size(bucketname, objectname)
+}
+
+func (s *usageStore) add(bucketname string, delta int64) {
+	if delta == 0 {
+		return
+	}
+	if _, err := metadata.AddBucketUsage(bucketname, delta); err != nil {
+		logx.Error("metadata AddBucketUsage error:", err.Error())
+	}
+}
+
+// 写入前原子预占容量，超出配额时撤销并返回 CodeQuotaExceeded，并发写入不会同时通过检查
+func (s *usageStore) reserve(bucketname string, quota, delta int64) error {
+	used, err := metadata.AddBucketUsage(bucketname, delta)
+	if err != nil {
+		return err
+	}
+	if delta > 0 && used > quota {
+		s.add(bucketname, -delta)
+		return errorx.New(errorx.CodeQuotaExceeded)
+	}
+	return nil
+}
+
+// 按 size 预占后写入，写入失败时撤销，大小未知时写入后再累加
+func (s *usageStore) put(bucketname, objectname string, size int64, put func() (int64, error)) (int64, error) {
+	quota := s.quota(bucketname)
+	if quota <= 0 {
+		return put()
+	}
+	old := s.replaced(bucketname, objectname)
+	var reserved int64
+	if size >= 0 {
+		reserved = size - old
+		if err := s.reserve(bucketname, quota, reserved); err != nil {
+			return 0, err
+		}
+	}
+	n, err := put()
+	if err != nil {
+		s.add(bucketname, -reserved)
+		return n, err
+	}
+	if size < 0 {
+		s.add(bucketname, n-old)
+	} else {
+		s.add(bucketname, n-size)
+	}
+	return n, nil
+}
+
+func (s *usageStore) PutObject(bucketname, objectname string, reader io.Reader, size int64, opts minio.PutObjectOptions) (int64, error) {
+	return s.put(bucketname, objectname, size, func() (int64, error) {
+		return s.ObjectStore.PutObject(bucketname, objectname, reader, size, opts)
+	})
+}
+
+func (s *usageStore) PutObjectMd5(bucketname, objectname string, reader io.Reader, size int64, md5Base64 string, opts minio.PutObjectOptions) (int64, error) {
+	return s.put(bucketname, objectname, size, func() (int64, error) {
+		return s.ObjectStore.PutObjectMd5(bucketname, objectname, reader, size, md5Base64, opts)
+	})
+}
+
+func (s *usageStore) MakeBucket(bucketname, location string) error {
+	s.forget(bucketname)
+	return s.ObjectStore.MakeBucket(bucketname, location)
+}
+
+func (s *usageStore) RemoveBucket(bucketname string) error {
+	s.forget(bucketname)
+	return s.ObjectStore.RemoveBucket(bucketname)
+}
+
+func (s *usageStore) SetBucketVersioning(bucketname string, enabled bool) error {
+	s.forget(bucketname)
+	return s.ObjectStore.SetBucketVersioning(bucketname, enabled)
+}
+
+func (s *usageStore) ComposeObject(bucketname, objectname string, srcs []SrcInfo, userMeta map[string]string) error {
+	if !s.tracked(bucketname) {
+		return s.ObjectStore.ComposeObject(bucketname, objectname, srcs, userMeta)
+	}
+	old := s.replaced(bucketname, objectname)
+	err := s.ObjectStore.ComposeObject(bucketname, objectname, srcs, userMeta)
+	if err == nil {
+		s.add(bucketname, s.size(bucketname, objectname)-old)
+	}
+	return err
+}
+
+// 复制的大小即源对象大小
+func (s *usageStore) CopyObject(bucketname, objectname string, src CopySrc, userMeta map[string]string) error {
+	_, err := s.put(bucketname, objectname, src.Size, func() (int64, error) {
+		return src.Size, s.ObjectStore.CopyObject(bucketname, objectname, src, userMeta)
+	})
+	return err
+}
+
+func (s *usageStore) CompleteMultipartUpload(bucketname, objectname, uploadID string, parts []minio.CompletePart) (string, error) {
+	if !s.tracked(bucketname) {
+		return s.ObjectStore.CompleteMultipartUpload(bucketname, objectname, uploadID, parts)
+	}
+	old := s.replaced(bucketname, objectname)
+	etag, err := s.ObjectStore.CompleteMultipartUpload(bucketname, objectname, uploadID, parts)
+	if err == nil {
+		s.add(bucketname, s.size(bucketname, objectname)-old)
+	}
+	return etag, err
+}
+
+func (s *usageStore) RemoveObject(bucketname, objectname string) error {
+	if !s.tracked(bucketname) || !s.unversioned(bucketname) {
+		return s.ObjectStore.RemoveObject(bucketname, objectname)
+	}
+	old := s.sizes(bucketname, []string{objectname})[objectname]
+	err := s.ObjectStore.RemoveObject(bucketname, objectname)
+	if err == nil {
+		s.add(bucketname, -old)
+	}
+	return err
+}
+
+func (s *usageStore) RemoveObjects(bucketname string, objectsCh <-chan string) <-chan minio.RemoveObjectError {
+	if !s.tracked(bucketname) || !s.unversioned(bucketname) {
+		return s.ObjectStore.RemoveObjects(bucketname, objectsCh)
+	}
+	// 删除前按批查询对象大小，删除完成后扣减删除成功的对象
+	var mu sync.Mutex
+	sizes := make(map[string]int64)
+	namesCh := make(chan string)
+	go func() {
+		defer close(namesCh)
+		batch := make([]string, 0, maxRemoveVersions)
+		flush := func() {
+			found := s.sizes(bucketname, batch)
+			mu.Lock()
+			for name, size := range found {
+				sizes[name] = size
+			}
+			mu.Unlock()
+			for _, name := range batch {
+				namesCh <- name
+			}
+			batch = batch[:0]
+		}
+		for name := range objectsCh {
+			batch = append(batch, name)
+			if len(batch) == cap(batch) {
+				flush()
+			}
+		}
+		if len(batch) > 0 {
+			flush()
+		}
+	}()
+	errorCh := make(chan minio.RemoveObjectError)
+	go func() {
+		defer close(errorCh)
+		failed := make(map[string]bool)
+		for e := range s.ObjectStore.RemoveObjects(bucketname, namesCh) {
+			failed[e.ObjectName] = true
+			errorCh <- e
+		}
+		var removed int64
+		mu.Lock()
+		for name, size := range sizes {
+			if !failed[name] {
+				removed += size
+			}
+		}
+		mu.Unlock()
+		s.add(bucketname, -removed)
+	}()
+	return errorCh
+}
+
+func (s *usageStore) RemoveObjectVersion(bucketname, objectname, versionId string) error {
+	if !s.tracked(bucketname) {
+		return s.ObjectStore.RemoveObjectVersion(bucketname, objectname, versionId)
+	}
+	var old int64
+	if stat, err := s.ObjectStore.StatObjectVersion(bucketname, objectname, versionId); err == nil {
+		old = stat.Size
+	}
+	err := s.ObjectStore.RemoveObjectVersion(bucketname, objectname, versionId)
+	if err == nil {
+		s.add(bucketname, -old)
+	}
+	return err
+}
+
+// 扣减删除成功的版本，大小使用列表返回的值，删除标记没有大小
+func (s *usageStore) RemoveObjectVersions(bucketname string, versions []ObjectVersion) ([]ObjectVersion, error) {
+	failed, err := s.ObjectStore.RemoveObjectVersions(bucketname, versions)
+	if err != nil || !s.tracked(bucketname) {
+		return failed, err
+	}
+	skip := make(map[string]bool, len(failed))
+	for _, v := range failed {
+		skip[v.Key+"\x00"+v.VersionId] = true
+	}
+	var removed int64
+	for _, v := range versions {
+		if !skip[v.Key+"\x00"+v.VersionId] && !v.IsDeleteMarker {
+			removed += v.Size
+		}
+	}
+	s.add(bucketname, -removed)
+	return failed, nil
+}
+
+// 重新统计桶的已用容量，开启过版本控制时包括历史版本
+func countBucketUsage(bucketname string) (int64, error) {
+	var used int64
+	if status, err := store.GetBucketVersioning(bucketname); err != nil {
+		return 0, err
+	} else if status != "" {
+		keyMarker, versionIdMarker := "", ""
+		for {
+			result, err := store.ListObjectVersions(bucketname, "", keyMarker, versionIdMarker, 1000)
+			if err != nil {
+				return 0, err
+			}
+			for _, v := range result.Versions {
+				if !v.IsDeleteMarker {
+					used += v.Size
+				}
+			}
+			if !result.IsTruncated {
+				return used, nil
+			}
+			keyMarker, versionIdMarker = result.NextKeyMarker, result.NextVersionIdMarker
+		}
+	}
+	doneCh := make(chan struct{})
+	defer close(doneCh)
+	for object := range store.ListObjects(bucketname, "", true, doneCh) {
+		if object.Err != nil {
+			return 0, object.Err
+		}
+		used += object.Size
+	}
+	return used, nil
+}
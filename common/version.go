@@ -0,0 +1,149 @@
+package common
+
+import (
+	"minio_demo/errorx"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/zituocn/logx"
+)
+
+type BucketVersioning struct {
+	// Enabled、Suspended，从未开启过时为空
+	Status string `json:"status"`
+}
+
+type VersionInfo struct {
+	ObjectName     string `json:"object_name"`
+	VersionId      string `json:"versionId"`
+	IsLatest       bool   `json:"isLatest"`
+	IsDeleteMarker bool   `json:"isDeleteMarker"`
+	LastModified   string `json:"lastModified"`
+	Size           int64  `json:"size"`
+	ETag           string `json:"etag"`
+}
+
+type VersionList struct {
+	Versions            []*VersionInfo `json:"versions"`
+	IsTruncated         bool           `json:"isTruncated"`
+	NextKeyMarker       string         `json:"nextKeyMarker,omitempty"`
+	NextVersionIdMarker string         `json:"nextVersionIdMarker,omitempty"`
+}
+
+// 开启或暂停版本控制，开启后无法关闭只能暂停
+func setBucketVersioning(bucketname, status string) error {
+	var enabled bool
+	switch strings.ToLower(status) {
+	case "enabled":
+		enabled = true
+	case "suspended":
+	default:
+		return errorx.WithMsg(errorx.CodeInternalParamsError, errorx.MsgInvalidVersioning)
+	}
+	if isExist, err := IsBuckets(bucketname); err != nil {
+		return err
+	} else if !isExist {
+		return errorx.New(errorx.CodeBucketNotFound)
+	}
+	return store.SetBucketVersioning(bucketname, enabled)
+}
+
+// 分页查询对象版本和删除标记：prefix、key_marker、version_id_marker、max_keys
+func listVersionPage(bucketname string, r *http.Request) (*VersionList, error) {
+	maxKeys := maxListKeys
+	if v := r.FormValue("max_keys"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxListKeys {
+			return nil, errorx.WithMsg(errorx.CodeInternalParamsError, errorx.MsgInvalidListOptions)
+		}
+		maxKeys = n
+	}
+	result, err := store.ListObjectVersions(bucketname, r.FormValue("prefix"), r.FormValue("key_marker"), r.FormValue("version_id_marker"), maxKeys)
+	if err != nil {
+		return nil, err
+	}
+	list := &VersionList{
+		Versions:            make([]*VersionInfo, 0, len(result.Versions)),
+		IsTruncated:         result.IsTruncated,
+		NextKeyMarker:       result.NextKeyMarker,
+		NextVersionIdMarker: result.NextVersionIdMarker,
+	}
+	for _, v := range result.Versions {
+		list.Versions = append(list.Versions, &VersionInfo{
+			ObjectName:     v.Key,
+			VersionId:      v.VersionId,
+			IsLatest:       v.IsLatest,
+			IsDeleteMarker: v.IsDeleteMarker,
+			LastModified:   v.LastModified.Format("2006-01-02 15:04:05"),
+			Size:           v.Size,
+			ETag:           removeBackslashAndQuotes(v.ETag),
+		})
+	}
+	return list, nil
+}
+
+// 永久删除指定版本，同时删除指向该版本的文件记录
+func removeObjectVersion(bucketname, objectname, versionId string) error {
+	// 删除标记没有文件记录，查询时返回 MethodNotAllowed
+	info, err := GetStatObjectVersion(bucketname, objectname, versionId)
+	if err != nil && errorx.From(err).Code != errorx.CodeMethodNotAllowed {
+		return err
+	}
+	if err := store.RemoveObjectVersion(bucketname, objectname, versionId); err != nil {
+		return err
+	}
+	if info == nil {
+		return nil
+	}
+	info.Md5 = removeBackslashAndQuotes(info.Md5)
+	// 合并上传的对象 ETag 不是md5，使用记录中校验过的md5
+	if record, err := metadata.GetByName(bucketname, objectname); err == nil && sameVersion(record, info) {
+		info.Md5 = record.Md5
+	}
+	if err := metadata.DeleteVersion(info); err != nil {
+		logx.Error("metadata DeleteVersion error:", err.Error())
+	}
+	return nil
+}
+
+// 开启或暂停版本控制
+func SetBucketVersioning(w http.ResponseWriter, r *http.Request) {
+	bucketname := r.PostFormValue("bucket_name")
+	if !checkPermission(w, r, bucketname, ActionAdmin) {
+		return
+	}
+	if err := setBucketVersioning(bucketname, r.PostFormValue("status")); err != nil {
+		errorx.WriteOk(w, r, err)
+		return
+	}
+	errorx.Ok(w, r, nil)
+}
+
+// 查询版本控制状态
+func GetBucketVersioning(w http.ResponseWriter, r *http.Request) {
+	bucketname := r.FormValue("bucket_name")
+	if !checkPermission(w, r, bucketname, ActionList) {
+		return
+	}
+	status, err := store.GetBucketVersioning(bucketname)
+	if err != nil {
+		errorx.WriteOk(w, r, err)
+		return
+	}
+	errorx.Ok(w, r, BucketVersioning{Status: status})
+}
+
+// 查询对象版本
+func ListObjectVersions(w http.ResponseWriter, r *http.Request) {
+	bucketname := r.FormValue("bucket_name")
+	if !checkPermission(w, r, bucketname, ActionList) {
+		return
+	}
+	list, err := listVersionPage(bucketname, r)
+	if err != nil {
+		errorx.WriteOk(w, r, err)
+		return
+	}
+	errorx.Ok(w, r, list)
+}
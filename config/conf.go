@@ -14,10 +14,18 @@ type Env struct {
 }
 
 type Config struct {
-	Log   Log
-	Host  Host
-	Redis Redis
-	Minio Minio
+	Log      Log
+	Host     Host
+	Redis    Redis
+	Minio    Minio
+	Storage  Storage
+	Upload   Upload
+	Janitor  Janitor
+	Presign  Presign
+	Auth     Auth
+	Policies []Policy
+	Cors     Cors
+	I18n     I18n
 }
 
 type Log struct {
@@ -41,6 +49,76 @@ type Minio struct {
 
 	AccessKeyID     string
 	SecretAccessKey string
+	Region          string // 创建桶的默认区域，默认 us-east-1
+	UseSSL          bool   // 使用 https 连接存储端
+}
+
+// 存储后端选择
+type Storage struct {
+	Object   string // minio(默认) 或 memory
+	Metadata string // redis(默认) 或 memory
+}
+
+// 分片上传
+type Upload struct {
+	SessionTTL      int // 上传会话过期时间(秒)，默认 86400
+	MergeTimeout    int // 合并锁过期时间(秒)，默认 600
+	ChunkExpireDays int // 未合并分片的过期天数，默认 7，小于 0 时不安装默认生命周期规则
+}
+
+// 后台清理任务，多实例部署时通过 Redis 锁保证同一时间只有一个实例执行
+type Janitor struct {
+	Enabled       bool
+	Interval      int // 执行间隔(秒)，默认 3600
+	SessionMaxAge int // 分片上传会话超过该时间(秒)未更新时清理，默认 43200，应小于 Upload.SessionTTL
+}
+
+// 预签名地址
+type Presign struct {
+	DefaultExpiry int   // 默认有效期(秒)，默认 900
+	MaxExpiry     int   // 最大有效期(秒)，不超过 604800
+	MaxPostSize   int64 // POST 表单上传的最大文件大小(字节)，0 表示不限制
+}
+
+// 认证，开启后所有接口都需要 API Key 或 JWT
+type Auth struct {
+	Enabled bool
+	ApiKeys []ApiKey
+	Jwt     Jwt
+}
+
+type ApiKey struct {
+	Key       string
+	Principal string
+}
+
+type Jwt struct {
+	HmacSecret   string // HS256 密钥
+	RsaPublicKey string // RS256 公钥，PEM 内容或文件路径
+	Issuer       string // 非空时校验 iss
+	Audience     string // 非空时校验 aud
+}
+
+// 桶权限策略
+type Policy struct {
+	Principal string   // 调用方，* 表示所有已认证的调用方
+	Buckets   []string // 桶名，支持 * ? 通配符
+	Actions   []string // list、read、write、delete、admin，admin 包含全部权限
+}
+
+// 跨域，未配置 AllowOrigins 时不允许任何跨域请求
+type Cors struct {
+	AllowOrigins     []string // 允许的来源，支持 * 和 https://*.example.com
+	AllowMethods     []string
+	AllowHeaders     []string
+	ExposeHeaders    []string
+	AllowCredentials bool
+	MaxAge           int // 预检结果缓存时间(秒)
+}
+
+// 响应信息语言，请求头 Accept-Language 优先
+type I18n struct {
+	DefaultLang string // zh-CN(默认) 或 en-US
 }
 
 var EnvData = &Env{}
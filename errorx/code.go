@@ -0,0 +1,84 @@
+package errorx
+
+import "net/http"
+
+// 业务错误码，对外稳定，新增只能追加在末尾
+type Code int64
+
+const (
+	CodeSuccess Code = 1000 + iota
+	CodeInternalServerError
+	CodeInternalParamsError
+	CodeServerBusy
+	CodeChecksumMismatch
+	CodeChunkChecksumMismatch
+	CodeUnauthorized
+	CodeForbidden
+	CodeBucketNotFound
+	CodeObjectNotFound
+	CodeBucketNotEmpty
+	CodeBucketExists
+	CodeInvalidBucketName
+	CodeQuotaExceeded
+	CodeUploadNotFound
+	CodeInvalidPart
+	CodeEntityTooSmall
+	CodeEntityTooLarge
+	CodeInvalidRange
+	CodeNotFound
+	CodeMethodNotAllowed
+	CodeStorageUnavailable
+	CodeVersionNotFound
+)
+
+var codeStatusMap = map[Code]int{
+	CodeSuccess:               http.StatusOK,
+	CodeInternalServerError:   http.StatusInternalServerError,
+	CodeInternalParamsError:   http.StatusBadRequest,
+	CodeServerBusy:            http.StatusServiceUnavailable,
+	CodeChecksumMismatch:      http.StatusBadRequest,
+	CodeChunkChecksumMismatch: http.StatusBadRequest,
+	CodeUnauthorized:          http.StatusUnauthorized,
+	CodeForbidden:             http.StatusForbidden,
+	CodeBucketNotFound:        http.StatusNotFound,
+	CodeObjectNotFound:        http.StatusNotFound,
+	CodeBucketNotEmpty:        http.StatusConflict,
+	CodeBucketExists:          http.StatusConflict,
+	CodeInvalidBucketName:     http.StatusBadRequest,
+	CodeQuotaExceeded:         http.StatusInsufficientStorage,
+	CodeUploadNotFound:        http.StatusNotFound,
+	CodeInvalidPart:           http.StatusBadRequest,
+	CodeEntityTooSmall:        http.StatusBadRequest,
+	CodeEntityTooLarge:        http.StatusRequestEntityTooLarge,
+	CodeInvalidRange:          http.StatusRequestedRangeNotSatisfiable,
+	CodeNotFound:              http.StatusNotFound,
+	CodeMethodNotAllowed:      http.StatusMethodNotAllowed,
+	CodeStorageUnavailable:    http.StatusServiceUnavailable,
+	CodeVersionNotFound:       http.StatusNotFound,
+}
+
+// 默认语言的错误码提示信息
+func (c Code) Msg() string {
+	return c.MsgIn(DefaultLang())
+}
+
+func (c Code) MsgIn(lang string) string {
+	catalog := codeCatalog[lang]
+	if catalog == nil {
+		catalog = codeCatalog[LangZhCN]
+	}
+	msg, ok := catalog[c]
+	if !ok {
+		msg = catalog[CodeServerBusy]
+	}
+	return msg
+}
+
+// 错误码对应的 HTTP 状态码
+func (c Code) Status() int {
+	status, ok := codeStatusMap[c]
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+	return status
+}
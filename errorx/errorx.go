@@ -0,0 +1,161 @@
+package errorx
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/minio/minio-go"
+	"github.com/zeromicro/go-zero/rest/httpx"
+	"github.com/zituocn/logx"
+)
+
+// 请求 ID 响应头，由 middleware.RequestId 写入
+const RequestIdHeader = "X-Request-Id"
+
+// 统一响应结构
+type Response struct {
+	Code      Code        `json:"code"`
+	Msg       interface{} `json:"msg"`
+	Data      interface{} `json:"data"`
+	RequestId string      `json:"request_id,omitempty"`
+}
+
+// 业务错误，Err 为原始错误，只记录日志不返回给调用方
+type Error struct {
+	Code  Code
+	MsgId MsgId
+	Args  []interface{}
+	Err   error
+	// 随错误返回给调用方的数据，如批量操作失败前已完成的进度
+	Data interface{}
+}
+
+func New(code Code) *Error {
+	return &Error{Code: code}
+}
+
+// 自定义提示信息，用于参数错误等需要说明原因的场景
+func WithMsg(code Code, id MsgId, args ...interface{}) *Error {
+	return &Error{Code: code, MsgId: id, Args: args}
+}
+
+func Wrap(code Code, err error) *Error {
+	return &Error{Code: code, Err: err}
+}
+
+// 附带返回给调用方的数据，不修改原错误
+func (e *Error) WithData(data interface{}) *Error {
+	v := *e
+	v.Data = data
+	return &v
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message(DefaultLang()) + ": " + e.Err.Error()
+	}
+	return e.Message(DefaultLang())
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// 返回给调用方的提示信息
+func (e *Error) Message(lang string) string {
+	if e.MsgId != "" {
+		return T(lang, e.MsgId, e.Args...)
+	}
+	return e.Code.MsgIn(lang)
+}
+
+// 存储错误码对应的业务错误码
+var minioCodeMap = map[string]Code{
+	"NoSuchBucket":                   CodeBucketNotFound,
+	"NoSuchKey":                      CodeObjectNotFound,
+	"NoSuchObject":                   CodeObjectNotFound,
+	"BucketNotEmpty":                 CodeBucketNotEmpty,
+	"BucketAlreadyOwnedByYou":        CodeBucketExists,
+	"BucketAlreadyExists":            CodeBucketExists,
+	"InvalidBucketName":              CodeInvalidBucketName,
+	"NoSuchUpload":                   CodeUploadNotFound,
+	"InvalidPart":                    CodeInvalidPart,
+	"InvalidPartOrder":               CodeInvalidPart,
+	"EntityTooSmall":                 CodeEntityTooSmall,
+	"EntityTooLarge":                 CodeEntityTooLarge,
+	"InvalidRange":                   CodeInvalidRange,
+	"InvalidArgument":                CodeInternalParamsError,
+	"MalformedXML":                   CodeInternalParamsError,
+	"AccessDenied":                   CodeForbidden,
+	"XMinioAdminBucketQuotaExceeded": CodeQuotaExceeded,
+	"XMinioStorageFull":              CodeQuotaExceeded,
+	"SlowDown":                       CodeServerBusy,
+	"ServiceUnavailable":             CodeStorageUnavailable,
+	"XMinioServerNotInitialized":     CodeStorageUnavailable,
+	"NoSuchVersion":                  CodeVersionNotFound,
+	"MethodNotAllowed":               CodeMethodNotAllowed,
+	"BadDigest":                      CodeChecksumMismatch,
+}
+
+// 转换为业务错误，存储返回的错误按错误码映射，其他错误视为内部错误
+func From(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	if code, ok := minioCodeMap[minio.ToErrorResponse(err).Code]; ok {
+		return Wrap(code, err)
+	}
+	return Wrap(CodeInternalServerError, err)
+}
+
+func writeJson(w http.ResponseWriter, status int, lang string, res Response) {
+	res.RequestId = w.Header().Get(RequestIdHeader)
+	w.Header().Set("Content-Language", lang)
+	httpx.WriteJson(w, status, res)
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, err error, ok bool) {
+	e := From(err)
+	if e.Err != nil {
+		logx.Errorf("request_id:%s code:%d error:%s", w.Header().Get(RequestIdHeader), e.Code, e.Err.Error())
+	}
+	status := e.Code.Status()
+	if ok {
+		status = http.StatusOK
+	}
+	lang := Lang(r)
+	writeJson(w, status, lang, Response{
+		Code: e.Code,
+		Msg:  e.Message(lang),
+		Data: e.Data,
+	})
+}
+
+// 写入错误响应，HTTP 状态码由错误码决定
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	writeError(w, r, err, false)
+}
+
+// 旧接口兼容，HTTP 状态码固定为 200
+func WriteOk(w http.ResponseWriter, r *http.Request, err error) {
+	writeError(w, r, err, true)
+}
+
+// 写入成功响应
+func WriteData(w http.ResponseWriter, r *http.Request, status int, id MsgId, data interface{}, args ...interface{}) {
+	lang := Lang(r)
+	writeJson(w, status, lang, Response{
+		Code: CodeSuccess,
+		Msg:  T(lang, id, args...),
+		Data: data,
+	})
+}
+
+func Ok(w http.ResponseWriter, r *http.Request, data interface{}) {
+	WriteData(w, r, http.StatusOK, MsgSuccess, data)
+}
+
+func OkMsg(w http.ResponseWriter, r *http.Request, id MsgId, data interface{}, args ...interface{}) {
+	WriteData(w, r, http.StatusOK, id, data, args...)
+}
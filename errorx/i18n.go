@@ -0,0 +1,239 @@
+package errorx
+
+import (
+	"fmt"
+	"minio_demo/config"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	LangZhCN = "zh-CN"
+	LangEnUS = "en-US"
+)
+
+// 提示信息 ID，错误码之外需要说明具体原因的提示信息
+type MsgId string
+
+const (
+	MsgSuccess               MsgId = "success"
+	MsgBucketCreated         MsgId = "bucket_created"
+	MsgBucketRemoved         MsgId = "bucket_removed"
+	MsgUploaded              MsgId = "uploaded"
+	MsgInstantUpload         MsgId = "instant_upload"
+	MsgContinueUpload        MsgId = "continue_upload"
+	MsgUploadFailed          MsgId = "upload_failed"
+	MsgInvalidChunkSize      MsgId = "invalid_chunk_size"
+	MsgInvalidTotalSize      MsgId = "invalid_total_size"
+	MsgChecksumAlgorithm     MsgId = "checksum_algorithm"
+	MsgInvalidPartNumber     MsgId = "invalid_part_number"
+	MsgInvalidParts          MsgId = "invalid_parts"
+	MsgNoPartsUploaded       MsgId = "no_parts_uploaded"
+	MsgFileRequired          MsgId = "file_required"
+	MsgContentLengthRequired MsgId = "content_length_required"
+	MsgInvalidSizeRange      MsgId = "invalid_size_range"
+	MsgInvalidObjectNames    MsgId = "invalid_object_names"
+	MsgInvalidListOptions    MsgId = "invalid_list_options"
+	MsgConfirmBucketName     MsgId = "confirm_bucket_name"
+	MsgBucketExists          MsgId = "bucket_exists"
+	MsgInvalidBucketOptions  MsgId = "invalid_bucket_options"
+	MsgInvalidCopyOptions    MsgId = "invalid_copy_options"
+	MsgObjectCopied          MsgId = "object_copied"
+	MsgObjectMoved           MsgId = "object_moved"
+	MsgInvalidObjectMeta     MsgId = "invalid_object_meta"
+	MsgInvalidVersioning     MsgId = "invalid_versioning"
+	MsgInvalidLifecycle      MsgId = "invalid_lifecycle"
+	MsgChecksumPerFile       MsgId = "checksum_per_file"
+)
+
+var codeCatalog = map[string]map[Code]string{
+	LangZhCN: {
+		CodeSuccess:               "success",
+		CodeInternalServerError:   "内部服务器错误",
+		CodeInternalParamsError:   "参数错误",
+		CodeServerBusy:            "未知错误",
+		CodeChecksumMismatch:      "文件校验失败",
+		CodeChunkChecksumMismatch: "分片校验失败，请重新上传",
+		CodeUnauthorized:          "未认证",
+		CodeForbidden:             "没有权限",
+		CodeBucketNotFound:        "存储桶不存在",
+		CodeObjectNotFound:        "文件不存在",
+		CodeBucketNotEmpty:        "存储桶不为空",
+		CodeBucketExists:          "存储桶已存在",
+		CodeInvalidBucketName:     "存储桶名称不合法",
+		CodeQuotaExceeded:         "超出存储配额",
+		CodeUploadNotFound:        "上传任务不存在",
+		CodeInvalidPart:           "分段不存在或ETag不匹配",
+		CodeEntityTooSmall:        "分段小于最小限制",
+		CodeEntityTooLarge:        "文件超出大小限制",
+		CodeInvalidRange:          "请求范围无效",
+		CodeNotFound:              "资源不存在",
+		CodeMethodNotAllowed:      "不支持的请求方法",
+		CodeStorageUnavailable:    "存储服务不可用",
+		CodeVersionNotFound:       "文件版本不存在",
+	},
+	LangEnUS: {
+		CodeSuccess:               "success",
+		CodeInternalServerError:   "Internal server error",
+		CodeInternalParamsError:   "Invalid parameters",
+		CodeServerBusy:            "Unknown error",
+		CodeChecksumMismatch:      "File checksum mismatch",
+		CodeChunkChecksumMismatch: "Chunk checksum mismatch, please upload again",
+		CodeUnauthorized:          "Unauthorized",
+		CodeForbidden:             "Permission denied",
+		CodeBucketNotFound:        "Bucket not found",
+		CodeObjectNotFound:        "Object not found",
+		CodeBucketNotEmpty:        "Bucket is not empty",
+		CodeBucketExists:          "Bucket already exists",
+		CodeInvalidBucketName:     "Invalid bucket name",
+		CodeQuotaExceeded:         "Storage quota exceeded",
+		CodeUploadNotFound:        "Upload not found",
+		CodeInvalidPart:           "Part not found or ETag mismatch",
+		CodeEntityTooSmall:        "Part is smaller than the minimum size",
+		CodeEntityTooLarge:        "File exceeds the maximum size",
+		CodeInvalidRange:          "Requested range not satisfiable",
+		CodeNotFound:              "Resource not found",
+		CodeMethodNotAllowed:      "Method not allowed",
+		CodeStorageUnavailable:    "Storage service unavailable",
+		CodeVersionNotFound:       "Object version not found",
+	},
+}
+
+var msgCatalog = map[string]map[MsgId]string{
+	LangZhCN: {
+		MsgSuccess:               "success",
+		MsgBucketCreated:         "创建桶成功",
+		MsgBucketRemoved:         "删除%s桶成功",
+		MsgUploaded:              "上传成功",
+		MsgInstantUpload:         "文件已在系统内，秒传成功！",
+		MsgContinueUpload:        "继续上传",
+		MsgUploadFailed:          "上传失败",
+		MsgInvalidChunkSize:      "分片大小无效",
+		MsgInvalidTotalSize:      "文件大小无效",
+		MsgChecksumAlgorithm:     "不支持的校验算法",
+		MsgInvalidPartNumber:     "分段编号无效，范围为 1-10000",
+		MsgInvalidParts:          "分段列表格式错误",
+		MsgNoPartsUploaded:       "没有已上传的分段",
+		MsgFileRequired:          "缺少上传文件",
+		MsgContentLengthRequired: "缺少 Content-Length 请求头",
+		MsgInvalidSizeRange:      "文件大小范围无效",
+		MsgInvalidObjectNames:    "文件列表不能为空且不能超过 %d 个",
+		MsgInvalidListOptions:    "查询条件无效",
+		MsgConfirmBucketName:     "强制删除需要 confirm 参数与桶名一致",
+		MsgBucketExists:          "桶已存在",
+		MsgInvalidBucketOptions:  "桶配置参数无效",
+		MsgInvalidCopyOptions:    "复制参数无效",
+		MsgObjectCopied:          "复制成功",
+		MsgObjectMoved:           "移动成功",
+		MsgInvalidObjectMeta:     "文件元数据或标签无效",
+		MsgInvalidVersioning:     "版本控制状态只能为 Enabled 或 Suspended",
+		MsgInvalidLifecycle:      "生命周期规则不合法",
+		MsgChecksumPerFile:       "多个文件需要分别通过 checksum_<字段名> 提供校验值",
+	},
+	LangEnUS: {
+		MsgSuccess:               "success",
+		MsgBucketCreated:         "Bucket created",
+		MsgBucketRemoved:         "Bucket %s removed",
+		MsgUploaded:              "Successfully upload",
+		MsgInstantUpload:         "File already exists, upload skipped",
+		MsgContinueUpload:        "Continue uploading",
+		MsgUploadFailed:          "Upload failed",
+		MsgInvalidChunkSize:      "Invalid chunk size",
+		MsgInvalidTotalSize:      "Invalid total size",
+		MsgChecksumAlgorithm:     "Unsupported checksum algorithm",
+		MsgInvalidPartNumber:     "Invalid part number, must be 1-10000",
+		MsgInvalidParts:          "Invalid parts",
+		MsgNoPartsUploaded:       "No parts uploaded",
+		MsgFileRequired:          "File is required",
+		MsgContentLengthRequired: "Content-Length header required",
+		MsgInvalidSizeRange:      "Invalid size range",
+		MsgInvalidObjectNames:    "Object names must contain 1 to %d keys",
+		MsgInvalidListOptions:    "Invalid list options",
+		MsgConfirmBucketName:     "Force removal requires confirm to match the bucket name",
+		MsgBucketExists:          "Bucket already exists",
+		MsgInvalidBucketOptions:  "Invalid bucket options",
+		MsgInvalidCopyOptions:    "Invalid copy options",
+		MsgObjectCopied:          "Object copied",
+		MsgObjectMoved:           "Object moved",
+		MsgInvalidObjectMeta:     "Invalid object metadata or tags",
+		MsgInvalidVersioning:     "Versioning status must be Enabled or Suspended",
+		MsgInvalidLifecycle:      "Invalid lifecycle rules",
+		MsgChecksumPerFile:       "Multiple files require a checksum_<field> for each file",
+	},
+}
+
+// 提示信息，缺少翻译时使用中文
+func T(lang string, id MsgId, args ...interface{}) string {
+	msg, ok := msgCatalog[lang][id]
+	if !ok {
+		msg, ok = msgCatalog[LangZhCN][id]
+	}
+	if !ok {
+		msg = string(id)
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(msg, args...)
+	}
+	return msg
+}
+
+// 配置的默认语言，未配置或不支持时使用中文
+func DefaultLang() string {
+	if lang := matchLang(config.ConfData.I18n.DefaultLang); lang != "" {
+		return lang
+	}
+	return LangZhCN
+}
+
+// 按 Accept-Language 选择语言，没有匹配时使用默认语言
+func Lang(r *http.Request) string {
+	header := r.Header.Get("Accept-Language")
+	if header == "" {
+		return DefaultLang()
+	}
+	type candidate struct {
+		lang string
+		q    float64
+	}
+	candidates := make([]candidate, 0)
+	for _, v := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(v), ";")
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if f, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = f
+				}
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+		candidates = append(candidates, candidate{lang: strings.TrimSpace(fields[0]), q: q})
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+	for _, v := range candidates {
+		if v.lang == "*" {
+			return DefaultLang()
+		}
+		if lang := matchLang(v.lang); lang != "" {
+			return lang
+		}
+	}
+	return DefaultLang()
+}
+
+// 按语言前缀匹配支持的语言，zh-TW、en-GB 等分别使用中文和英文
+func matchLang(tag string) string {
+	tag = strings.ToLower(tag)
+	switch {
+	case tag == "zh" || strings.HasPrefix(tag, "zh-") || strings.HasPrefix(tag, "zh_"):
+		return LangZhCN
+	case tag == "en" || strings.HasPrefix(tag, "en-") || strings.HasPrefix(tag, "en_"):
+		return LangEnUS
+	}
+	return ""
+}
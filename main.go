@@ -17,20 +17,41 @@ func main() {
 	config.InitConfig()
 	common.InitRedis()
 	common.InitMinio()
+	common.InitLifecycle()
+	common.InitJanitor()
 	mux := http.NewServeMux()
-	mux.Handle("/create_bucket", middleware.Cors(http.HandlerFunc(common.CreateBucket)))
-	mux.Handle("/remove_bucket", middleware.Cors(http.HandlerFunc(common.RemoveBucket)))
-	mux.Handle("/put_object", middleware.Cors(http.HandlerFunc(common.PutObject)))
-	mux.Handle("/list_object", middleware.Cors(http.HandlerFunc(common.ListObjects)))
-	mux.Handle("/upload", middleware.Cors(http.HandlerFunc(common.Upload)))
-	mux.Handle("/download", middleware.Cors(http.HandlerFunc(common.DownLoad)))
-	mux.Handle("/get_bucket_list", middleware.Cors(http.HandlerFunc(common.GetBucketList)))
-	mux.Handle("/stat_object", middleware.Cors(http.HandlerFunc(common.GetObjectInfo)))
-	mux.Handle("/test", middleware.Cors(http.HandlerFunc(common.Test)))
+	mux.Handle("/create_bucket", middleware.Cors(middleware.Auth(http.HandlerFunc(common.CreateBucket))))
+	mux.Handle("/remove_bucket", middleware.Cors(middleware.Auth(http.HandlerFunc(common.RemoveBucket))))
+	mux.Handle("/put_object", middleware.Cors(middleware.Auth(http.HandlerFunc(common.PutObject))))
+	mux.Handle("/remove_object", middleware.Cors(middleware.Auth(http.HandlerFunc(common.RemoveObject))))
+	mux.Handle("/remove_objects", middleware.Cors(middleware.Auth(http.HandlerFunc(common.RemoveObjects))))
+	mux.Handle("/copy_object", middleware.Cors(middleware.Auth(http.HandlerFunc(common.CopyObject))))
+	mux.Handle("/move_object", middleware.Cors(middleware.Auth(http.HandlerFunc(common.MoveObject))))
+	mux.Handle("/set_bucket_versioning", middleware.Cors(middleware.Auth(http.HandlerFunc(common.SetBucketVersioning))))
+	mux.Handle("/get_bucket_versioning", middleware.Cors(middleware.Auth(http.HandlerFunc(common.GetBucketVersioning))))
+	mux.Handle("/list_object_versions", middleware.Cors(middleware.Auth(http.HandlerFunc(common.ListObjectVersions))))
+	mux.Handle("/get_bucket_lifecycle", middleware.Cors(middleware.Auth(http.HandlerFunc(common.GetBucketLifecycle))))
+	mux.Handle("/set_bucket_lifecycle", middleware.Cors(middleware.Auth(http.HandlerFunc(common.SetBucketLifecycle))))
+	mux.Handle("/delete_bucket_lifecycle", middleware.Cors(middleware.Auth(http.HandlerFunc(common.DeleteBucketLifecycle))))
+	mux.Handle("/list_object", middleware.Cors(middleware.Auth(http.HandlerFunc(common.ListObjects))))
+	mux.Handle("/upload", middleware.Cors(middleware.Auth(http.HandlerFunc(common.Upload))))
+	mux.Handle("/multipart/initiate", middleware.Cors(middleware.Auth(http.HandlerFunc(common.InitiateMultipartUpload))))
+	mux.Handle("/multipart/upload_part", middleware.Cors(middleware.Auth(http.HandlerFunc(common.UploadPart))))
+	mux.Handle("/multipart/complete", middleware.Cors(middleware.Auth(http.HandlerFunc(common.CompleteMultipartUpload))))
+	mux.Handle("/multipart/abort", middleware.Cors(middleware.Auth(http.HandlerFunc(common.AbortMultipartUpload))))
+	mux.Handle("/download", middleware.Cors(middleware.Auth(http.HandlerFunc(common.DownLoad))))
+	mux.Handle("/presigned_get_object", middleware.Cors(middleware.Auth(http.HandlerFunc(common.PresignedGetObject))))
+	mux.Handle("/presigned_put_object", middleware.Cors(middleware.Auth(http.HandlerFunc(common.PresignedPutObject))))
+	mux.Handle("/presigned_post_policy", middleware.Cors(middleware.Auth(http.HandlerFunc(common.PresignedPostPolicy))))
+	mux.Handle("/get_bucket_list", middleware.Cors(middleware.Auth(http.HandlerFunc(common.GetBucketList))))
+	mux.Handle("/janitor_stats", middleware.Cors(middleware.Auth(http.HandlerFunc(common.GetJanitorStats))))
+	mux.Handle("/stat_object", middleware.Cors(middleware.Auth(http.HandlerFunc(common.GetObjectInfo))))
+	mux.Handle("/api/v1/", middleware.Cors(middleware.Auth(http.HandlerFunc(common.RestV1))))
+	mux.Handle("/test", middleware.Cors(middleware.Auth(http.HandlerFunc(common.Test))))
 	server := &http.Server{
 		Addr:         config.ConfData.Host.Address + ":" + strconv.Itoa(config.ConfData.Host.Port),
 		WriteTimeout: time.Second * 300,
-		Handler:      mux,
+		Handler:      middleware.RequestId(mux),
 	}
 	logx.SetWriter(io.MultiWriter(
 		os.Stdout,
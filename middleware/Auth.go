@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"minio_demo/config"
+	"minio_demo/errorx"
+	"net/http"
+	"strings"
+
+	"github.com/zituocn/logx"
+)
+
+const (
+	PrincipalApiKey = "apikey"
+	PrincipalJwt    = "jwt"
+)
+
+// 调用方身份
+type Principal struct {
+	Name   string
+	Type   string
+	Claims map[string]interface{}
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// 获取请求的调用方身份，未开启认证时返回 nil
+func PrincipalFrom(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
+
+var errUnauthorized = errors.New("unauthorized")
+
+// Auth 认证，支持 X-Api-Key 请求头和 Authorization: Bearer <jwt>
+func Auth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 预检请求不带认证信息
+		if !config.ConfData.Auth.Enabled || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		principal, err := authenticate(r)
+		if err != nil {
+			logx.Notice("auth failed: " + err.Error())
+			w.Header().Set("WWW-Authenticate", `Bearer realm="minio_demo"`)
+			errorx.Write(w, r, errorx.New(errorx.CodeUnauthorized))
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), principal)))
+	})
+}
+
+func authenticate(r *http.Request) (*Principal, error) {
+	if key := r.Header.Get("X-Api-Key"); key != "" {
+		return authenticateApiKey(key)
+	}
+	if auth := r.Header.Get("Authorization"); len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		return authenticateJwt(strings.TrimSpace(auth[7:]))
+	}
+	return nil, errUnauthorized
+}
+
+func authenticateApiKey(key string) (*Principal, error) {
+	for _, v := range config.ConfData.Auth.ApiKeys {
+		if v.Key != "" && subtle.ConstantTimeCompare([]byte(v.Key), []byte(key)) == 1 {
+			return &Principal{Name: v.Principal, Type: PrincipalApiKey}, nil
+		}
+	}
+	return nil, errors.New("invalid api key")
+}
+
+func authenticateJwt(token string) (*Principal, error) {
+	claims, err := verifyJwt(token, config.ConfData.Auth.Jwt)
+	if err != nil {
+		return nil, err
+	}
+	sub, _ := claims["sub"].(string)
+	if sub == "" {
+		return nil, errors.New("jwt missing sub")
+	}
+	return &Principal{Name: sub, Type: PrincipalJwt, Claims: claims}, nil
+}
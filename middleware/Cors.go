@@ -1,30 +1,97 @@
 package middleware
 
 import (
+	"minio_demo/config"
 	"net/http"
+	"strconv"
+	"strings"
 )
 
-// Cors 跨域
+var (
+	defaultAllowMethods  = []string{"GET", "POST", "PUT", "DELETE", "HEAD", "OPTIONS"}
+	defaultAllowHeaders  = []string{"Authorization", "Content-Type", "X-Api-Key", "Range", "If-None-Match", "If-Modified-Since", "Content-MD5"}
+	defaultExposeHeaders = []string{"Content-Length", "Content-Range", "Content-Disposition", "Accept-Ranges", "ETag", "Last-Modified"}
+)
+
+// Cors 跨域，按配置的来源白名单放行，预检请求直接返回
 func Cors(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// w.Header().Set("Content-Type", "application/json")
-		// w.Header().Set("Access-Control-Allow-Credentials", "true")
-		// w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Length, X-CSRF-Token, Token,session,X_Requested_With,Accept, Origin, Host, Connection, Accept-Encoding, Accept-Language,DNT, X-CustomHeader, Keep-Alive, User-Agent, X-Requested-With, If-Modified-Since, Cache-Control, Content-Type, Pragma")
-		// w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE,UPDATE")
-		// w.Header().Set("Access-Control-Allow-Origin", "http://127.0.0.1:8081")
-		// w.Header().Set("Access-Control-Expose-Headers", "Content-Length, Access-Control-Allow-Origin, Access-Control-Allow-Headers,Cache-Control,Content-Language,Content-Type,Expires,Last-Modified,Pragma,FooBar")
-
-		w.Header().Set("Access-Control-Allow-Origin", r.Header.Get("Origin"))
-
-		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE,UPDATE") // 服务器支持的所有跨域请求的方法,为了避免浏览次请求的多次'预检'请求
-		//  header的类型
-		w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Length, X-CSRF-Token, Token,session,X_Requested_With,Accept, Origin, Host, Connection, Accept-Encoding, Accept-Language,DNT, X-CustomHeader, Keep-Alive, User-Agent, X-Requested-With, If-Modified-Since, Cache-Control, Content-Type, Pragma")
-		// 允许跨域设置                                                                                                      可以返回其他子段
-		w.Header().Set("Access-Control-Expose-Headers", "Content-Length, Access-Control-Allow-Origin, Access-Control-Allow-Headers,Cache-Control,Content-Language,Content-Type,Expires,Last-Modified,Pragma,FooBar") // 跨域关键设置 让浏览器可以解析
-		w.Header().Set("Access-Control-Max-Age", "172800")                                                                                                                                                           // 缓存请求信息 单位为秒
-		w.Header().Set("Access-Control-Allow-Credentials", "true")                                                                                                                                                   //  跨域请求是否需要带cookie信息 默认设置为true
-		w.Header().Set("content-type", "application/json")
+		conf := config.ConfData.Cors
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		// 同源请求或非浏览器请求
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Origin")
+		if !originAllowed(conf.AllowOrigins, origin) {
+			if preflight {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			// 不返回跨域头，由浏览器拦截响应
+			next.ServeHTTP(w, r)
+			return
+		}
 
+		// 携带凭证时不能使用 *
+		if !conf.AllowCredentials && hasWildcard(conf.AllowOrigins) {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+		if conf.AllowCredentials {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if preflight {
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+			w.Header().Set("Access-Control-Allow-Methods", strings.Join(orDefault(conf.AllowMethods, defaultAllowMethods), ", "))
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(orDefault(conf.AllowHeaders, defaultAllowHeaders), ", "))
+			if conf.MaxAge > 0 {
+				w.Header().Set("Access-Control-Max-Age", strconv.Itoa(conf.MaxAge))
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		w.Header().Set("Access-Control-Expose-Headers", strings.Join(orDefault(conf.ExposeHeaders, defaultExposeHeaders), ", "))
 		next.ServeHTTP(w, r)
 	})
 }
+
+func orDefault(values, defaults []string) []string {
+	if len(values) == 0 {
+		return defaults
+	}
+	return values
+}
+
+func hasWildcard(origins []string) bool {
+	for _, v := range origins {
+		if v == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// 来源是否在白名单中，https://*.example.com 匹配 example.com 的任意子域名
+func originAllowed(origins []string, origin string) bool {
+	for _, v := range origins {
+		if v == "*" || strings.EqualFold(v, origin) {
+			return true
+		}
+		if i := strings.Index(v, "*"); i >= 0 {
+			prefix, suffix := strings.ToLower(v[:i]), strings.ToLower(v[i+1:])
+			o := strings.ToLower(origin)
+			if len(o) > len(prefix)+len(suffix) && strings.HasPrefix(o, prefix) && strings.HasSuffix(o, suffix) {
+				return true
+			}
+		}
+	}
+	return false
+}
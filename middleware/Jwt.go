@@ -0,0 +1,153 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"minio_demo/config"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 允许的时钟误差
+const jwtLeeway = 60 * time.Second
+
+var (
+	rsaKeyOnce sync.Once
+	rsaKey     *rsa.PublicKey
+	rsaKeyErr  error
+)
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+}
+
+// 校验 HS256/RS256 签名和 exp、nbf、iss、aud，返回 claims
+func verifyJwt(token string, conf config.Jwt) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed jwt")
+	}
+	headerData, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errors.New("malformed jwt header")
+	}
+	header := jwtHeader{}
+	if err := json.Unmarshal(headerData, &header); err != nil {
+		return nil, errors.New("malformed jwt header")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed jwt signature")
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+	switch header.Alg {
+	case "HS256":
+		if conf.HmacSecret == "" {
+			return nil, errors.New("HS256 not configured")
+		}
+		mac := hmac.New(sha256.New, []byte(conf.HmacSecret))
+		mac.Write(signed)
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return nil, errors.New("invalid jwt signature")
+		}
+	case "RS256":
+		key, err := rsaPublicKey(conf.RsaPublicKey)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(signed)
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, sum[:], signature); err != nil {
+			return nil, errors.New("invalid jwt signature")
+		}
+	default:
+		return nil, errors.New("unsupported jwt alg " + header.Alg)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errors.New("malformed jwt payload")
+	}
+	claims := make(map[string]interface{})
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, errors.New("malformed jwt payload")
+	}
+
+	now := time.Now()
+	if exp, ok := claims["exp"].(float64); ok && now.After(time.Unix(int64(exp), 0).Add(jwtLeeway)) {
+		return nil, errors.New("jwt expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(jwtLeeway).Before(time.Unix(int64(nbf), 0)) {
+		return nil, errors.New("jwt not valid yet")
+	}
+	if conf.Issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != conf.Issuer {
+			return nil, errors.New("invalid jwt issuer")
+		}
+	}
+	if conf.Audience != "" && !hasAudience(claims["aud"], conf.Audience) {
+		return nil, errors.New("invalid jwt audience")
+	}
+	return claims, nil
+}
+
+// aud 可以是字符串或字符串数组
+func hasAudience(aud interface{}, audience string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == audience
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok && s == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// 解析 RS256 公钥，支持 PEM 内容或文件路径，只解析一次
+func rsaPublicKey(value string) (*rsa.PublicKey, error) {
+	rsaKeyOnce.Do(func() {
+		if value == "" {
+			rsaKeyErr = errors.New("RS256 not configured")
+			return
+		}
+		data := []byte(value)
+		if !strings.Contains(value, "-----BEGIN") {
+			data, rsaKeyErr = os.ReadFile(value)
+			if rsaKeyErr != nil {
+				return
+			}
+		}
+		block, _ := pem.Decode(data)
+		if block == nil {
+			rsaKeyErr = errors.New("invalid RS256 public key")
+			return
+		}
+		if key, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+			if rsaPub, ok := key.(*rsa.PublicKey); ok {
+				rsaKey = rsaPub
+				return
+			}
+		}
+		if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+			if rsaPub, ok := cert.PublicKey.(*rsa.PublicKey); ok {
+				rsaKey = rsaPub
+				return
+			}
+		}
+		rsaKey, rsaKeyErr = x509.ParsePKCS1PublicKey(block.Bytes)
+	})
+	return rsaKey, rsaKeyErr
+}